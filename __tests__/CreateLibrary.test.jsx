@@ -22,6 +22,7 @@ describe('CreateLibrary Component', () => {
     expect(screen.getByPlaceholderText('Owner Name')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Owner Email')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Owner Contact')).toBeInTheDocument();
+    expect(screen.getByPlaceholderText('Owner Password')).toBeInTheDocument();
     
     // Check that the "Create Library" button exists
     expect(screen.getByRole('button', { name: /Create Library/i })).toBeInTheDocument();
@@ -45,6 +46,7 @@ describe('CreateLibrary Component', () => {
     fireEvent.change(screen.getByPlaceholderText('Owner Name'), { target: { value: 'Admin Name' } });
     fireEvent.change(screen.getByPlaceholderText('Owner Email'), { target: { value: 'admin@example.com' } });
     fireEvent.change(screen.getByPlaceholderText('Owner Contact'), { target: { value: '1234567890' } });
+    fireEvent.change(screen.getByPlaceholderText('Owner Password'), { target: { value: 'secret123' } });
     
     // Submit the form by clicking the "Create Library" button
     fireEvent.click(screen.getByRole('button', { name: /Create Library/i }));
@@ -59,7 +61,8 @@ describe('CreateLibrary Component', () => {
       libraryName: 'My Library',
       ownerName: 'Admin Name',
       ownerEmail: 'admin@example.com',
-      ownerContact: '1234567890'
+      ownerContact: '1234567890',
+      ownerPassword: 'secret123'
     });
   });
 });
@@ -27,11 +27,28 @@ describe('CreateReader Component', () => {
     expect(screen.getByPlaceholderText('Email')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Contact Number')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Library ID')).toBeInTheDocument();
+    expect(screen.getByPlaceholderText('Password')).toBeInTheDocument();
     
     // Wait for library data to load and be displayed
     expect(await screen.findByText(/Library 1/i)).toBeInTheDocument();
   });
 
+  it('lists the libraries of every page', async () => {
+    api.getLibrariesAPI
+      .mockResolvedValueOnce({ libraries: [{ id: 1, name: 'Library 1', numBooks: 10 }], next: '/api/libraries?page=2&pageSize=100' })
+      .mockResolvedValueOnce({ libraries: [{ id: 101, name: 'Library 101', numBooks: 3 }], next: null });
+
+    render(
+      <BrowserRouter>
+        <CreateReader />
+      </BrowserRouter>
+    );
+
+    expect(await screen.findByText(/Library 101/i)).toBeInTheDocument();
+    expect(screen.getByText(/Library 1\b/i)).toBeInTheDocument();
+    expect(api.getLibrariesAPI).toHaveBeenNthCalledWith(2, { pageSize: 100, page: 2 });
+  });
+
   it('submits the form and calls createReaderAPI', async () => {
     // Arrange: 
     // First, mock getLibrariesAPI to return an empty list (or any list)
@@ -50,6 +67,7 @@ describe('CreateReader Component', () => {
     fireEvent.change(screen.getByPlaceholderText('Email'), { target: { value: 'testreader@example.com' } });
     fireEvent.change(screen.getByPlaceholderText('Contact Number'), { target: { value: '1234567890' } });
     fireEvent.change(screen.getByPlaceholderText('Library ID'), { target: { value: '1' } });
+    fireEvent.change(screen.getByPlaceholderText('Password'), { target: { value: 'secret123' } });
     
     // Submit the form by clicking the "Create Reader" button
     fireEvent.click(screen.getByRole('button', { name: /Create Reader/i }));
@@ -65,6 +83,7 @@ describe('CreateReader Component', () => {
       email: 'testreader@example.com',
       contactNumber: '1234567890',
       libID: 1,
+      password: 'secret123',
     });
   });
 });
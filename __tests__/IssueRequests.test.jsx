@@ -49,6 +49,29 @@ describe('IssueRequests Component', () => {
     });
   });
 
+  it('pages through pending requests', async () => {
+    const request = (ID, BookID) => ({ ID, BookID, ReaderID: 2, RequestDate: new Date().toISOString() });
+    api.getIssueRequestsAPI
+      .mockResolvedValueOnce({ requests: [request(1, '1111111111')], page: 1, pageSize: 1, total: 2, next: '/api/admin/requests?page=2&pageSize=1' })
+      .mockResolvedValueOnce({ requests: [request(2, '2222222222')], page: 2, pageSize: 1, total: 2, next: null });
+    render(
+      <BrowserRouter>
+        <IssueRequests />
+      </BrowserRouter>
+    );
+    await waitFor(() => {
+      expect(screen.getByText(/Showing 1–1 of 2/)).toBeInTheDocument();
+    });
+
+    fireEvent.click(screen.getByRole('button', { name: /Next page/i }));
+
+    await waitFor(() => {
+      expect(screen.getByText(/2222222222/)).toBeInTheDocument();
+    });
+    expect(api.getIssueRequestsAPI).toHaveBeenLastCalledWith({ page: 2 });
+    expect(screen.getByRole('button', { name: /Next page/i })).toBeDisabled();
+  });
+
   /*it('renders "No issue requests found" and redirects when there are no requests', async () => {
     api.getIssueRequestsAPI.mockResolvedValueOnce({ requests: [] });
     render(
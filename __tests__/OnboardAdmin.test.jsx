@@ -24,6 +24,7 @@ describe('OnboardAdmin Component', () => {
     expect(screen.getByPlaceholderText('Name')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Email')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Contact Number')).toBeInTheDocument();
+    expect(screen.getByPlaceholderText('Password')).toBeInTheDocument();
     
     // Verify that the "Onboard Admin" button exists
     expect(screen.getByRole('button', { name: /Onboard Admin/i })).toBeInTheDocument();
@@ -46,6 +47,7 @@ describe('OnboardAdmin Component', () => {
     fireEvent.change(screen.getByPlaceholderText('Name'), { target: { value: 'Admin Name' } });
     fireEvent.change(screen.getByPlaceholderText('Email'), { target: { value: 'admin@example.com' } });
     fireEvent.change(screen.getByPlaceholderText('Contact Number'), { target: { value: '1234567890' } });
+    fireEvent.change(screen.getByPlaceholderText('Password'), { target: { value: 'secret123' } });
     
     // Submit the form by clicking the "Onboard Admin" button
     fireEvent.click(screen.getByRole('button', { name: /Onboard Admin/i }));
@@ -60,6 +62,7 @@ describe('OnboardAdmin Component', () => {
       name: 'Admin Name',
       email: 'admin@example.com',
       contactNumber: '1234567890',
+      password: 'secret123',
     });
   });
 });
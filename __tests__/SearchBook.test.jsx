@@ -18,6 +18,7 @@ describe('SearchBook Component', () => {
     );
     
     // Check that the input fields and buttons are rendered
+    expect(screen.getByPlaceholderText('Search title, author or publisher')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Title')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Author')).toBeInTheDocument();
     expect(screen.getByPlaceholderText('Publisher')).toBeInTheDocument();
@@ -37,7 +38,12 @@ describe('SearchBook Component', () => {
           version: '1.0',
           total_copies: 5,
           available_copies: 0,
-          availability: 'Not available, expected return: 2025-03-30'
+          availability: {
+            available: false,
+            next_return_date: '2025-03-30',
+            hold_queue_length: 2,
+            estimated_available_date: '2025-04-13'
+          }
         }
       ]
     });
@@ -60,7 +66,7 @@ describe('SearchBook Component', () => {
     });
     
     // Also verify that availability info is displayed
-    expect(screen.getByText(/Not available, expected return:/i)).toBeInTheDocument();
+    expect(screen.getByText(/Not available, estimated available: 2025-04-13/i)).toBeInTheDocument();
   });
 
   it('calls alert on clicking "Raise Issue Request"', async () => {
@@ -80,7 +86,12 @@ describe('SearchBook Component', () => {
           version: '1.0',
           total_copies: 5,
           available_copies: 2,
-          availability: 'Available'
+          availability: {
+            available: true,
+            next_return_date: null,
+            hold_queue_length: 0,
+            estimated_available_date: null
+          }
         }
       ]
     });
@@ -112,4 +123,54 @@ describe('SearchBook Component', () => {
     
     alertSpy.mockRestore();
   });
+
+  it('shows the total and fetches the next page of results', async () => {
+    const book = (isbn, title) => ({
+      isbn,
+      title,
+      authors: 'Test Author',
+      publisher: 'Test Publisher',
+      version: '1.0',
+      total_copies: 1,
+      available_copies: 1,
+      availability: { available: true, next_return_date: null, hold_queue_length: 0, estimated_available_date: null }
+    });
+    api.searchBooksAPI
+      .mockResolvedValueOnce({
+        books: [book('1111111111', 'First Page Book')],
+        page: 1,
+        pageSize: 1,
+        total: 2,
+        next: '/api/reader/books?page=2&pageSize=1'
+      })
+      .mockResolvedValueOnce({
+        books: [book('2222222222', 'Second Page Book')],
+        page: 2,
+        pageSize: 1,
+        total: 2,
+        next: null
+      });
+
+    render(
+      <BrowserRouter>
+        <SearchBook />
+      </BrowserRouter>
+    );
+
+    fireEvent.change(screen.getByPlaceholderText('Title'), { target: { value: 'Book' } });
+    fireEvent.click(screen.getByRole('button', { name: /Search/i }));
+    await waitFor(() => {
+      expect(screen.getByText(/Showing 1–1 of 2/)).toBeInTheDocument();
+    });
+    expect(screen.getByRole('button', { name: /Previous page/i })).toBeDisabled();
+
+    fireEvent.click(screen.getByRole('button', { name: /Next page/i }));
+
+    await waitFor(() => {
+      expect(screen.getByText(/Second Page Book/i)).toBeInTheDocument();
+    });
+    expect(api.searchBooksAPI).toHaveBeenLastCalledWith(expect.objectContaining({ title: 'Book', page: 2 }));
+    expect(screen.getByText(/Showing 2–2 of 2/)).toBeInTheDocument();
+    expect(screen.getByRole('button', { name: /Next page/i })).toBeDisabled();
+  });
 });
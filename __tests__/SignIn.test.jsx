@@ -33,6 +33,7 @@ describe('SignIn Component', () => {
     );
 
     expect(screen.getByPlaceholderText('Enter your email')).toBeInTheDocument();
+    expect(screen.getByPlaceholderText('Enter your password')).toBeInTheDocument();
     expect(screen.getByRole('button', { name: /Sign In/i })).toBeInTheDocument();
   });
 
@@ -47,14 +48,15 @@ describe('SignIn Component', () => {
       </BrowserRouter>
     );
 
-    // Act: simulate entering an email and submitting the form
+    // Act: simulate entering credentials and submitting the form
     const emailInput = screen.getByPlaceholderText('Enter your email');
     fireEvent.change(emailInput, { target: { value: 'test@example.com' } });
+    fireEvent.change(screen.getByPlaceholderText('Enter your password'), { target: { value: 'secret123' } });
     fireEvent.click(screen.getByRole('button', { name: /Sign In/i }));
 
     // Assert: wait for the API call, localStorage update, and navigation to occur
     await waitFor(() => {
-      expect(api.signInAPI).toHaveBeenCalledWith('test@example.com');
+      expect(api.signInAPI).toHaveBeenCalledWith('test@example.com', 'secret123');
       expect(localStorage.getItem('user')).toEqual(JSON.stringify(mockUser));
       expect(mockNavigate).toHaveBeenCalledWith('/dashboard');
     });
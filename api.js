@@ -1,15 +1,64 @@
 // API helper functions to interact with the backend endpoints.
-export async function signInAPI(email) {
+
+// Stores the token pair returned by sign in or refresh.
+function storeTokens(data) {
+  localStorage.setItem('accessToken', data.accessToken);
+  localStorage.setItem('refreshToken', data.refreshToken);
+}
+
+async function refreshTokens() {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) {
+    return false;
+  }
+  const response = await fetch('/api/token/refresh', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ refreshToken }),
+  });
+  if (!response.ok) {
+    return false;
+  }
+  storeTokens(await response.json());
+  return true;
+}
+
+// Returns headers that make a state-changing call safe to retry.
+function idempotencyHeaders() {
+  return { 'Idempotency-Key': crypto.randomUUID() };
+}
+
+// Calls an authenticated endpoint, refreshing the access token once if it expired.
+async function authFetch(url, options = {}) {
+  const send = () =>
+    fetch(url, {
+      ...options,
+      headers: {
+        'Content-Type': 'application/json',
+        Authorization: `Bearer ${localStorage.getItem('accessToken')}`,
+        ...options.headers,
+      },
+    });
+  const response = await send();
+  if (response.status === 401 && (await refreshTokens())) {
+    return send();
+  }
+  return response;
+}
+
+export async function signInAPI(email, password) {
   const response = await fetch('/api/signin', {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
-    body: JSON.stringify({ email }),
+    body: JSON.stringify({ email, password }),
   });
   if (!response.ok) {
     const errorData = await response.json();
     throw new Error(errorData.error || 'Sign in failed');
   }
-  return await response.json();
+  const data = await response.json();
+  storeTokens(data);
+  return data.user;
 }
 
 export async function createLibraryAPI(data) {
@@ -39,14 +88,8 @@ export async function createReaderAPI(data) {
 }
 
 export async function onboardAdminAPI(data) {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const response = await fetch('/api/owner/admin/create', {
+  const response = await authFetch('/api/owner/admin/create', {
     method: 'POST',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
     body: JSON.stringify(data),
   });
   if (!response.ok) {
@@ -57,14 +100,8 @@ export async function onboardAdminAPI(data) {
 }
 
 export async function addBookAPI(data) {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const response = await fetch('/api/admin/books', {
+  const response = await authFetch('/api/admin/books', {
     method: 'POST',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
     body: JSON.stringify(data),
   });
   if (!response.ok) {
@@ -74,15 +111,37 @@ export async function addBookAPI(data) {
   return await response.json();
 }
 
+// Imports books from a CSV, MARC 21 or MARCXML file. With dryRun the report
+// shows what would change without changing anything.
+export async function importBooksAPI(file, { format = 'csv', dryRun = false, chunkSize = 0, startRow = 1 } = {}) {
+  const params = new URLSearchParams({ format, dryRun, chunkSize, startRow });
+  const response = await authFetch(`/api/admin/books/import?${params}`, {
+    method: 'POST',
+    headers: { 'Content-Type': file.type || 'text/csv', ...idempotencyHeaders() },
+    body: file,
+  });
+  const data = await response.json();
+  if (!response.ok) {
+    throw new Error(data.error || 'Import failed');
+  }
+  return data;
+}
+
+// Downloads the library's catalog as MARC 21 ('marc') or MARCXML ('marcxml').
+export async function exportBooksAPI(format = 'csv', { columns, ...filters } = {}) {
+  const params = new URLSearchParams({ format, ...filters });
+  if (columns && columns.length) params.set('columns', columns.join(','));
+  const response = await authFetch(`/api/admin/books/export?${params}`);
+  if (!response.ok) {
+    const errorData = await response.json();
+    throw new Error(errorData.error || 'Export failed');
+  }
+  return await response.blob();
+}
+
 export async function removeBookAPI(isbn, data) {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const response = await fetch(`/api/admin/books/${isbn}`, {
+  const response = await authFetch(`/api/admin/books/${isbn}`, {
     method: 'DELETE',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
     body: JSON.stringify(data),
   });
   if (!response.ok) {
@@ -93,14 +152,8 @@ export async function removeBookAPI(isbn, data) {
 }
 
 export async function updateBookAPI(isbn, data) {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const response = await fetch(`/api/admin/books/${isbn}`, {
+  const response = await authFetch(`/api/admin/books/${isbn}`, {
     method: 'PUT',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
     body: JSON.stringify(data),
   });
   if (!response.ok) {
@@ -110,15 +163,10 @@ export async function updateBookAPI(isbn, data) {
   return await response.json();
 }
 
-export async function getIssueRequestsAPI() {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const response = await fetch(`/api/admin/requests`, {
+export async function getIssueRequestsAPI(query = {}) {
+  const params = new URLSearchParams(query);
+  const response = await authFetch(`/api/admin/requests?${params.toString()}`, {
     method: 'GET',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
   });
   if (!response.ok) {
     const errorData = await response.json();
@@ -128,14 +176,9 @@ export async function getIssueRequestsAPI() {
 }
 
 export async function approveIssueRequestAPI(reqid) {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const response = await fetch(`/api/admin/requests/${reqid}/approve`, {
+  const response = await authFetch(`/api/admin/requests/${reqid}/approve`, {
     method: 'POST',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
+    headers: idempotencyHeaders(),
   });
   if (!response.ok) {
     const errorData = await response.json();
@@ -144,15 +187,11 @@ export async function approveIssueRequestAPI(reqid) {
   return await response.json();
 }
 
-export async function rejectIssueRequestAPI(reqid) {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const response = await fetch(`/api/admin/requests/${reqid}/reject`, {
+export async function rejectIssueRequestAPI(reqid, reason) {
+  const response = await authFetch(`/api/admin/requests/${reqid}/reject`, {
     method: 'POST',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
+    headers: idempotencyHeaders(),
+    body: reason ? JSON.stringify({ reason }) : undefined,
   });
   if (!response.ok) {
     const errorData = await response.json();
@@ -161,16 +200,25 @@ export async function rejectIssueRequestAPI(reqid) {
   return await response.json();
 }
 
+export async function cancelIssueRequestAPI(reqid) {
+  const response = await authFetch(`/api/reader/requests/${reqid}/cancel`, {
+    method: 'POST',
+  });
+  if (!response.ok) {
+    const errorData = await response.json();
+    throw new Error(errorData.error || 'Cancel failed');
+  }
+  return await response.json();
+}
+
 export async function searchBooksAPI(query) {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const params = new URLSearchParams(query);
-  const response = await fetch(`/api/reader/books?${params.toString()}`, {
+  // Array values, such as facet selections, repeat their parameter.
+  const params = new URLSearchParams();
+  Object.entries(query).forEach(([key, value]) => {
+    [].concat(value).forEach((v) => params.append(key, v));
+  });
+  const response = await authFetch(`/api/reader/books?${params.toString()}`, {
     method: 'GET',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
   });
   if (!response.ok) {
     const errorData = await response.json();
@@ -180,14 +228,9 @@ export async function searchBooksAPI(query) {
 }
 
 export async function raiseIssueRequestAPI(data) {
-  const user = JSON.parse(localStorage.getItem('user'));
-  const email = user.email || user.Email;
-  const response = await fetch('/api/reader/request', {
+  const response = await authFetch('/api/reader/request', {
     method: 'POST',
-    headers: {
-      'Content-Type': 'application/json',
-      'X-User-Email': email,
-    },
+    headers: idempotencyHeaders(),
     body: JSON.stringify(data),
   });
   if (!response.ok) {
@@ -197,8 +240,9 @@ export async function raiseIssueRequestAPI(data) {
   return await response.json();
 }
 
-export async function getLibrariesAPI() {
-  const response = await fetch('/api/libraries', {
+export async function getLibrariesAPI(query = {}) {
+  const params = new URLSearchParams(query);
+  const response = await fetch(`/api/libraries?${params.toString()}`, {
     method: 'GET',
     headers: { 'Content-Type': 'application/json' },
   });
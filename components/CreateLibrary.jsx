@@ -7,6 +7,7 @@ const CreateLibrary = () => {
   const [ownerName, setOwnerName] = useState('');
   const [ownerEmail, setOwnerEmail] = useState('');
   const [ownerContact, setOwnerContact] = useState('');
+  const [ownerPassword, setOwnerPassword] = useState('');
   const [error, setError] = useState('');
   const [message, setMessage] = useState('');
   const navigate = useNavigate();
@@ -14,7 +15,7 @@ const CreateLibrary = () => {
   const handleCreateLibrary = async (e) => {
     e.preventDefault();
     try {
-      await createLibraryAPI({ libraryName, ownerName, ownerEmail, ownerContact });
+      await createLibraryAPI({ libraryName, ownerName, ownerEmail, ownerContact, ownerPassword });
       setMessage('Library created successfully');
       navigate('/');
     } catch (err) {
@@ -56,6 +57,15 @@ const CreateLibrary = () => {
           onChange={(e) => setOwnerContact(e.target.value)}
           className="input-field"
         />
+        <input
+          type="password"
+          placeholder="Owner Password"
+          value={ownerPassword}
+          onChange={(e) => setOwnerPassword(e.target.value)}
+          required
+          minLength={8}
+          className="input-field"
+        />
         {error && <p className="center-text" style={{ color: 'red' }}>{error}</p>}
         {message && <p className="center-text" style={{ color: 'green' }}>{message}</p>}
         <button type="submit" className="button-primary">
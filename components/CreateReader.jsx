@@ -7,6 +7,7 @@ const CreateReader = () => {
   const [email, setEmail] = useState('');
   const [contactNumber, setContactNumber] = useState('');
   const [libId, setLibId] = useState('');
+  const [password, setPassword] = useState('');
   const [error, setError] = useState('');
   const [message, setMessage] = useState('');
   const [libraries, setLibraries] = useState([]);
@@ -14,8 +15,13 @@ const CreateReader = () => {
 
   const fetchLibraries = async () => {
     try {
-      const data = await getLibrariesAPI();
-      const libs = Array.isArray(data.libraries) ? data.libraries : [];
+      // Follow the pages until next is null so every library can be chosen.
+      const libs = [];
+      for (let page = 1; ; page++) {
+        const data = await getLibrariesAPI({ pageSize: 100, page });
+        libs.push(...(Array.isArray(data.libraries) ? data.libraries : []));
+        if (!data.next) break;
+      }
       setLibraries(libs);
     } catch (err) {
       console.error('Failed to fetch libraries', err);
@@ -33,7 +39,8 @@ const CreateReader = () => {
         name,
         email,
         contactNumber,  // key must be exactly "contactNumber"
-        libID: Number(libId)  // key must be "libID" and value converted to a number
+        libID: Number(libId),  // key must be "libID" and value converted to a number
+        password
       });
          
       setMessage('Reader created successfully');
@@ -79,6 +86,15 @@ const CreateReader = () => {
             required
             className="input-field"
           />
+          <input
+            type="password"
+            placeholder="Password"
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+            required
+            minLength={8}
+            className="input-field"
+          />
           {error && <p className="center-text" style={{ color: 'red' }}>{error}</p>}
           {message && <p className="center-text" style={{ color: 'green' }}>{message}</p>}
           <button type="submit" className="button-primary">
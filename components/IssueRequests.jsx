@@ -1,18 +1,31 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { getIssueRequestsAPI, approveIssueRequestAPI, rejectIssueRequestAPI } from '../api/api';
+import Pager from './Pager';
 
 const IssueRequests = () => {
   const [requests, setRequests] = useState([]);
   const [error, setError] = useState('');
   const [loading, setLoading] = useState(true);
+  const [page, setPage] = useState({ page: 1, pageSize: 20, total: 0, hasNext: false });
   const navigate = useNavigate();
 
-  const fetchRequests = async () => {
+  const fetchRequests = async (pageNumber = page.page) => {
     try {
-      const data = await getIssueRequestsAPI();
+      const data = await getIssueRequestsAPI({ page: pageNumber });
       const fetchedRequests = Array.isArray(data.requests) ? data.requests : [];
+      // Handling the last requests of a page empties it; show the one before.
+      if (fetchedRequests.length === 0 && pageNumber > 1) {
+        fetchRequests(pageNumber - 1);
+        return;
+      }
       setRequests(fetchedRequests);
+      setPage({
+        page: data.page || pageNumber,
+        pageSize: data.pageSize || fetchedRequests.length,
+        total: data.total ?? fetchedRequests.length,
+        hasNext: Boolean(data.next),
+      });
     } catch (err) {
       setError(err.message || 'Failed to fetch requests');
     } finally {
@@ -37,7 +50,7 @@ const IssueRequests = () => {
   const handleApprove = async (reqid) => {
     try {
       await approveIssueRequestAPI(reqid);
-      fetchRequests(); // Reload pending requests; approved ones won't appear since approval_date is set.
+      fetchRequests(); // Reload pending requests; approved ones won't appear since they are no longer Pending.
     } catch (err) {
       setError(err.message || 'Approve failed');
     }
@@ -46,7 +59,7 @@ const IssueRequests = () => {
   const handleReject = async (reqid) => {
     try {
       await rejectIssueRequestAPI(reqid);
-      setRequests(prev => prev.filter(r => (r.id || r.ID) !== reqid));
+      fetchRequests(); // Reload the page so the next pending request moves up into it.
     } catch (err) {
       setError(err.message || 'Reject failed');
     }
@@ -105,6 +118,14 @@ const IssueRequests = () => {
           </div>
         ))}
       </div>
+      <Pager
+        page={page.page}
+        pageSize={page.pageSize}
+        total={page.total}
+        count={requests.length}
+        hasNext={page.hasNext}
+        onPage={fetchRequests}
+      />
       <div className="center-text" style={{ marginTop: '20px' }}>
         <button onClick={() => navigate('/dashboard')} className="button-primary">
           Back to Dashboard
@@ -6,6 +6,7 @@ const OnboardAdmin = () => {
   const [name, setName] = useState('');
   const [email, setEmail] = useState('');
   const [contactNumber, setContactNumber] = useState('');
+  const [password, setPassword] = useState('');
   const [error, setError] = useState('');
   const [message, setMessage] = useState('');
   const navigate = useNavigate();
@@ -13,7 +14,7 @@ const OnboardAdmin = () => {
   const handleOnboardAdmin = async (e) => {
     e.preventDefault();
     try {
-      await onboardAdminAPI({ name, email, contactNumber });
+      await onboardAdminAPI({ name, email, contactNumber, password });
       setMessage('Admin onboarded successfully');
       navigate('/dashboard');
     } catch (err) {
@@ -48,6 +49,15 @@ const OnboardAdmin = () => {
           onChange={(e) => setContactNumber(e.target.value)}
           className="input-field"
         />
+        <input
+          type="password"
+          placeholder="Password"
+          value={password}
+          onChange={(e) => setPassword(e.target.value)}
+          required
+          minLength={8}
+          className="input-field"
+        />
         {error && <p className="center-text" style={{ color: 'red' }}>{error}</p>}
         {message && <p className="center-text" style={{ color: 'green' }}>{message}</p>}
         <button type="submit" className="button-primary">
@@ -0,0 +1,30 @@
+import React from 'react';
+
+// Shows which slice of a paginated list is on screen and moves between pages.
+// hasNext comes from the response's next link, which is null on the last page.
+const Pager = ({ page, pageSize, total, count, hasNext, onPage }) => {
+  if (total === 0) return null;
+  const first = (page - 1) * pageSize + 1;
+  return (
+    <div className="center-text" style={{ marginTop: '20px' }}>
+      <p>Showing {first}–{first + count - 1} of {total}</p>
+      <button
+        type="button"
+        onClick={() => onPage(page - 1)}
+        disabled={page <= 1}
+        className="button-primary"
+        style={{ marginRight: '10px' }}>
+        Previous page
+      </button>
+      <button
+        type="button"
+        onClick={() => onPage(page + 1)}
+        disabled={!hasNext}
+        className="button-primary">
+        Next page
+      </button>
+    </div>
+  );
+};
+
+export default Pager;
@@ -1,23 +1,57 @@
 import React, { useState } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { searchBooksAPI, raiseIssueRequestAPI } from '../api/api';
+import Pager from './Pager';
+
+// Query parameter that selects values of each facet in the search response.
+const FACET_PARAMS = {
+  publisher: 'facetPublisher',
+  author: 'facetAuthor',
+  availability: 'facetAvailability',
+  edition: 'facetEdition',
+};
+
+// Summarise a book's structured availability for the result card.
+const describeAvailability = ({ available, next_return_date, estimated_available_date }) => {
+  if (available) return 'Available';
+  if (estimated_available_date) return `Not available, estimated available: ${estimated_available_date}`;
+  if (next_return_date) return `Not available, expected return: ${next_return_date}`;
+  return 'Not available';
+};
 
 const SearchBook = () => {
+  const [q, setQ] = useState('');
   const [title, setTitle] = useState('');
   const [author, setAuthor] = useState('');
   const [publisher, setPublisher] = useState('');
+  const [fuzzy, setFuzzy] = useState(false);
   const [results, setResults] = useState([]);
+  const [suggestions, setSuggestions] = useState([]);
+  const [facets, setFacets] = useState({});
+  const [selected, setSelected] = useState({});
+  // The parameters of the search on screen, so its other pages can be fetched.
+  const [params, setParams] = useState({});
+  const [page, setPage] = useState({ page: 1, pageSize: 20, total: 0, hasNext: false });
   const [error, setError] = useState('');
   const [loading, setLoading] = useState(false);
   const navigate = useNavigate();
 
-  const handleSearch = async (e) => {
-    e.preventDefault();
+  const runSearch = async (query, pageNumber = 1) => {
     setLoading(true);
     setError('');
     try {
-      const data = await searchBooksAPI({ title, author, publisher });
-      setResults(data.books || []);
+      const data = await searchBooksAPI({ ...query, page: pageNumber });
+      const books = data.books || [];
+      setResults(books);
+      setSuggestions(data.suggestions || []);
+      setFacets(data.facets || {});
+      setParams(query);
+      setPage({
+        page: data.page || pageNumber,
+        pageSize: data.pageSize || books.length,
+        total: data.total ?? books.length,
+        hasNext: Boolean(data.next),
+      });
     } catch (err) {
       setError(err.message || 'Search failed');
     } finally {
@@ -25,6 +59,33 @@ const SearchBook = () => {
     }
   };
 
+  const handleSearch = (e) => {
+    e.preventDefault();
+    setSelected({});
+    runSearch({ q, title, author, publisher, fuzzy });
+  };
+
+  // Toggle a facet value and search again within the same results.
+  const handleFacet = (name, value) => {
+    const param = FACET_PARAMS[name];
+    const values = selected[param] || [];
+    const next = {
+      ...selected,
+      [param]: values.includes(value) ? values.filter((v) => v !== value) : [...values, value],
+    };
+    setSelected(next);
+    runSearch({ q, title, author, publisher, fuzzy, ...next });
+  };
+
+  // Re-run the search with a suggested value in place of what was typed.
+  const handleSuggestion = ({ param, value }) => {
+    const query = { q, title, author, publisher, fuzzy, ...selected, [param]: value };
+    setQ(query.q);
+    setTitle(query.title);
+    setAuthor(query.author);
+    runSearch(query);
+  };
+
   const handleRaiseRequest = async (isbn) => {
     try {
       await raiseIssueRequestAPI({ ISBN: isbn });
@@ -39,6 +100,13 @@ const SearchBook = () => {
       <div className="form-container" style={{ margin: '0 auto', minHeight: '50vh', textAlign: 'center' }}>
         <h2>Search Book</h2>
         <form onSubmit={handleSearch} className="form-container">
+          <input
+            type="text"
+            placeholder="Search title, author or publisher"
+            value={q}
+            onChange={(e) => setQ(e.target.value)}
+            className="input-field"
+          />
           <input
             type="text"
             placeholder="Title"
@@ -60,12 +128,55 @@ const SearchBook = () => {
             onChange={(e) => setPublisher(e.target.value)}
             className="input-field"
           />
+          <label>
+            <input
+              type="checkbox"
+              checked={fuzzy}
+              onChange={(e) => setFuzzy(e.target.checked)}
+            />
+            {' '}Allow misspellings
+          </label>
           <button type="submit" className="button-primary">Search</button>
         </form>
         {loading && <p style={{ marginTop: '20px' }}>Loading...</p>}
         {error && <p style={{ color: 'red', marginTop: '20px' }}>{error}</p>}
+        {suggestions.length > 0 && (
+          <p style={{ marginTop: '20px' }}>
+            Did you mean:{' '}
+            {suggestions.map((suggestion) => (
+              <button
+                key={`${suggestion.param}:${suggestion.value}`}
+                type="button"
+                onClick={() => handleSuggestion(suggestion)}
+                className="button-primary"
+                style={{ marginRight: '10px' }}>
+                {suggestion.value}
+              </button>
+            ))}
+          </p>
+        )}
       </div>
 
+      {Object.keys(facets).length > 0 && (
+        <div style={{ display: 'flex', flexWrap: 'wrap', gap: '20px', justifyContent: 'center', marginTop: '20px' }}>
+          {Object.entries(FACET_PARAMS).map(([name, param]) => (facets[name] || []).length > 0 && (
+            <div key={name} className="card">
+              <p><strong>{name.charAt(0).toUpperCase() + name.slice(1)}</strong></p>
+              {facets[name].map(({ value, count }) => (
+                <label key={value} style={{ display: 'block' }}>
+                  <input
+                    type="checkbox"
+                    checked={(selected[param] || []).includes(value)}
+                    onChange={() => handleFacet(name, value)}
+                  />
+                  {' '}{value} ({count})
+                </label>
+              ))}
+            </div>
+          ))}
+        </div>
+      )}
+
       {results.length > 0 && (
         <div style={{ display: 'flex', flexWrap: 'wrap', gap: '20px', justifyContent: 'center', marginTop: '20px' }}>
           {results.map((book) => (
@@ -77,8 +188,10 @@ const SearchBook = () => {
               <p><strong>Version:</strong> {book.version}</p>
               <p><strong>Total Copies:</strong> {book.total_copies}</p>
               <p><strong>Available Copies:</strong> {book.available_copies}</p>
-              {/* New: Display availability information */}
-              <p><strong>Availability:</strong> {book.availability}</p>
+              <p><strong>Availability:</strong> {describeAvailability(book.availability)}</p>
+              {book.availability.hold_queue_length > 0 && (
+                <p><strong>Readers waiting:</strong> {book.availability.hold_queue_length}</p>
+              )}
               <button 
                 onClick={() => handleRaiseRequest(book.isbn)} 
                 className="button-primary" 
@@ -89,6 +202,16 @@ const SearchBook = () => {
           ))}
         </div>
       )}
+      {results.length > 0 && (
+        <Pager
+          page={page.page}
+          pageSize={page.pageSize}
+          total={page.total}
+          count={results.length}
+          hasNext={page.hasNext}
+          onPage={(n) => runSearch(params, n)}
+        />
+      )}
 
       <button onClick={() => navigate('/dashboard')} className="fixed-button">
         Return to Dashboard
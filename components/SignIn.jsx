@@ -4,13 +4,14 @@ import { signInAPI } from '../api/api';
 
 const SignIn = () => {
   const [email, setEmail] = useState('');
+  const [password, setPassword] = useState('');
   const [error, setError] = useState('');
   const navigate = useNavigate();
 
   const handleSignIn = async (e) => {
     e.preventDefault();
     try {
-      const user = await signInAPI(email);
+      const user = await signInAPI(email, password);
       localStorage.setItem('user', JSON.stringify(user));
       navigate('/dashboard');
     } catch (err) {
@@ -32,6 +33,16 @@ const SignIn = () => {
             style={{ width: '300px', height: '40px', borderRadius: '5px', border: '1px solid #ccc' }}
             required
           />
+          <br />
+          <input
+            type="password"
+            placeholder="Enter your password"
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+            className="input-field"
+            style={{ width: '300px', height: '40px', borderRadius: '5px', border: '1px solid #ccc', marginTop: '10px' }}
+            required
+          />
           {error && <p style={{ color: 'red', marginTop: '10px' }}>{error}</p>}
           <br />
           <button type="submit" className="button-primary" style={{ marginTop: '20px', width: '300px', height: '40px' }}>
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"lms/backend/config"
@@ -10,8 +14,10 @@ import (
 	"lms/backend/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // JSON payload for onboarding a LibraryAdmin.
@@ -19,6 +25,7 @@ type CreateAdminRequest struct {
 	Name          string `json:"name" binding:"required"`
 	Email         string `json:"email" binding:"required,email"`
 	ContactNumber string `json:"contactNumber"`
+	Password      string `json:"password" binding:"required,min=8"`
 }
 
 func CreateAdmin(c *gin.Context) {
@@ -39,12 +46,19 @@ func CreateAdmin(c *gin.Context) {
 		return
 	}
 
+	passwordHash, err := hashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+		return
+	}
+
 	newAdmin := models.User{
 		Name:          req.Name,
 		Email:         req.Email,
 		ContactNumber: req.ContactNumber,
 		Role:          "LibraryAdmin",
 		LibID:         owner.LibID,
+		PasswordHash:  passwordHash,
 	}
 	if err := config.DB.Create(&newAdmin).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create admin user"})
@@ -53,14 +67,19 @@ func CreateAdmin(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "Library admin created successfully", "admin": newAdmin})
 }
 
-// AddBookRequest defines the payload for adding a book.
+// AddBookRequest defines the payload for adding a book. Title, Authors,
+// Publisher and Version describe the edition and are only used when no library
+// has catalogued the ISBN yet; otherwise the shared record is reused as is.
 type AddBookRequest struct {
-	ISBN      string `json:"ISBN" binding:"required"`
-	Title     string `json:"Title" binding:"required"`
-	Authors   string `json:"Authors" binding:"required"`
-	Publisher string `json:"Publisher"`
-	Version   string `json:"Version"`
-	Copies    int    `json:"Copies" binding:"required,gt=0"`
+	ISBN          string `json:"ISBN" binding:"required"`
+	Title         string `json:"Title"`
+	Authors       string `json:"Authors"`
+	Publisher     string `json:"Publisher"`
+	Version       string `json:"Version"`
+	ShelfLocation string `json:"ShelfLocation"`
+	Copies        int    `json:"Copies" binding:"required,gt=0"`
+	// Items optionally describes each new copy; barcodes are generated otherwise.
+	Items []CopyInput `json:"Items"`
 }
 
 // AddBook adds a new book or increments copies if it already exists.
@@ -106,72 +125,139 @@ type AddBookRequest struct {
 	}
 }*/
 
+// errEditionRequired is returned by addBookCopies for an ISBN that no library
+// has catalogued when the request does not describe the edition.
+var errEditionRequired = errors.New("Title and Authors are required for a new ISBN")
+
+// addBookCopies adds the requested copies to the library's holding of an ISBN
+// inside tx. A library that does not hold the ISBN yet gets a new holding
+// attached to the shared edition, and the edition is created from the request
+// if nobody has catalogued it. It reports whether a new holding was created.
+func addBookCopies(tx *gorm.DB, libID uint, req AddBookRequest) (bool, error) {
+	var book models.Book
+	// The catalog is keyed on (lib_id, isbn); other libraries may hold the same ISBN.
+	err := tx.Where("isbn = ? AND lib_id = ?", req.ISBN, libID).First(&book).Error
+	if err == gorm.ErrRecordNotFound {
+		var edition models.Edition
+		err := tx.Where("isbn = ?", req.ISBN).First(&edition).Error
+		if err == gorm.ErrRecordNotFound {
+			if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Authors) == "" {
+				return false, errEditionRequired
+			}
+			edition = models.Edition{
+				ISBN:      req.ISBN,
+				Title:     strings.TrimSpace(req.Title),
+				Authors:   strings.TrimSpace(req.Authors),
+				Publisher: strings.TrimSpace(req.Publisher),
+				Version:   strings.TrimSpace(req.Version),
+			}
+			// Another library may catalogue the same ISBN at the same time;
+			// the first record wins.
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&edition).Error; err != nil {
+				return false, err
+			}
+		} else if err != nil {
+			return false, err
+		}
+
+		newBook := models.Book{
+			ISBN:            req.ISBN,
+			LibID:           libID,
+			ShelfLocation:   req.ShelfLocation,
+			TotalCopies:     req.Copies,
+			AvailableCopies: req.Copies,
+		}
+		if err := tx.Create(&newBook).Error; err != nil {
+			return false, err
+		}
+		_, err = createCopies(tx, req.ISBN, libID, req.Copies, req.Items)
+		return true, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The library already holds this book, so add the new copies. They serve
+	// readers waiting in the hold queue first.
+	copies, err := createCopies(tx, book.ISBN, libID, req.Copies, req.Items)
+	if err != nil {
+		return false, err
+	}
+	if _, err := promoteHolds(tx, book.ISBN, libID, copies); err != nil {
+		return false, err
+	}
+	return false, syncCopyCounts(tx, book.ISBN, libID)
+}
+
 func AddBook(c *gin.Context) {
 	var req AddBookRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid required book fields"})
 		return
 	}
+	isbn, ok := parseISBN(c, req.ISBN)
+	if !ok {
+		return
+	}
+	req.ISBN = isbn
+	if len(req.Items) > 0 && len(req.Items) != req.Copies {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Items must describe every copy being added"})
+		return
+	}
 
 	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
-	libID := user.LibID
 
-	var book models.Book
-	// Query only by ISBN to enforce global uniqueness.
-	err := config.DB.Where("isbn = ?", req.ISBN).First(&book).Error
+	tx := config.DB.Begin()
+	created, err := addBookCopies(tx, user.LibID, req)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// No book with this ISBN exists at all, create a new record.
-			newBook := models.Book{
-				ISBN:            req.ISBN,
-				LibID:           libID,
-				Title:           req.Title,
-				Authors:         req.Authors,
-				Publisher:       req.Publisher,
-				Version:         req.Version,
-				TotalCopies:     req.Copies,
-				AvailableCopies: req.Copies,
-			}
-			if err := config.DB.Create(&newBook).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error adding new book"})
-				return
-			}
-			c.JSON(http.StatusCreated, gin.H{"message": "Book added successfully"})
-			return
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error searching for book"})
+		tx.Rollback()
+		if err == errEditionRequired {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error adding book"})
+		return
 	}
-
-	// A book with this ISBN was found.
-	if book.LibID != libID {
-		// The same ISBN exists in a different library.
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Book with this ISBN already exists in another library"})
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit error"})
 		return
 	}
-	// Otherwise, the book is in the same library, so update the copies.
-	book.TotalCopies += req.Copies
-	book.AvailableCopies += req.Copies
-	if err := config.DB.Save(&book).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating book copies"})
+	if created {
+		c.JSON(http.StatusCreated, gin.H{"message": "Book added successfully"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Book copies updated"})
 }
 
-// Payload for remove a book
+// Payload for remove a book. Either name the copies to withdraw by barcode or
+// give a number of available copies to withdraw.
 type RemoveBookRequest struct {
-	CopiesToRemove int `json:"CopiesToRemove" binding:"required,gt=0"`
+	CopiesToRemove int      `json:"CopiesToRemove" binding:"omitempty,gt=0"`
+	Barcodes       []string `json:"Barcodes"`
 }
 
 func RemoveBook(c *gin.Context) {
-	isbn := c.Param("isbn")
+	isbn, ok := parseISBN(c, c.Param("isbn"))
+	if !ok {
+		return
+	}
 	var req RemoveBookRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	if req.CopiesToRemove == 0 && len(req.Barcodes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	seen := make(map[string]bool, len(req.Barcodes))
+	for _, barcode := range req.Barcodes {
+		if seen[barcode] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate barcode " + barcode})
+			return
+		}
+		seen[barcode] = true
+	}
 
 	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
 	libID := user.LibID
@@ -181,46 +267,212 @@ func RemoveBook(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
 		return
 	}
-	if req.CopiesToRemove > book.AvailableCopies {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove copies that are issued"})
+
+	tx := config.DB.Begin()
+
+	var copies []models.BookCopy
+	if len(req.Barcodes) > 0 {
+		if err := tx.Where("isbn = ? AND lib_id = ? AND barcode IN ? AND status <> ?", isbn, libID, req.Barcodes, models.CopyWithdrawn).
+			Find(&copies).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching copies"})
+			return
+		}
+		if len(copies) != len(req.Barcodes) {
+			tx.Rollback()
+			c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found"})
+			return
+		}
+		for _, bookCopy := range copies {
+			if bookCopy.Status != models.CopyAvailable {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove copies that are issued or on hold"})
+				return
+			}
+		}
+	} else {
+		if err := tx.Where("isbn = ? AND lib_id = ? AND status = ?", isbn, libID, models.CopyAvailable).
+			Order("id DESC").Limit(req.CopiesToRemove).Find(&copies).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching copies"})
+			return
+		}
+		if len(copies) < req.CopiesToRemove {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove copies that are issued or on hold"})
+			return
+		}
+	}
+
+	ids := make([]uint, 0, len(copies))
+	for _, bookCopy := range copies {
+		ids = append(ids, bookCopy.ID)
+	}
+	// The status condition keeps a copy issued in the meantime from being withdrawn.
+	res := tx.Model(&models.BookCopy{}).
+		Where("id IN ? AND status = ?", ids, models.CopyAvailable).
+		Update("status", models.CopyWithdrawn)
+	if res.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating book copies"})
+		return
+	}
+	if res.RowsAffected != int64(len(ids)) {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Copies changed, please retry"})
+		return
+	}
+	if err := syncCopyCounts(tx, isbn, libID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating book copies"})
+		return
+	}
+	if err := tx.Where("isbn = ? AND lib_id = ?", isbn, libID).First(&book).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating book copies"})
 		return
 	}
-	book.TotalCopies -= req.CopiesToRemove
-	book.AvailableCopies -= req.CopiesToRemove
 	if book.TotalCopies == 0 {
-		if err := config.DB.Delete(&book).Error; err != nil {
+		if err := tx.Delete(&book).Error; err != nil {
+			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error deleting book"})
 			return
 		}
-	} else {
-		if err := config.DB.Save(&book).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating book copies"})
+		// Requests for a book that no longer exists can never be served.
+		if err := tx.Model(&models.RequestEvent{}).
+			Where("book_id = ? AND lib_id = ? AND status = ?", isbn, libID, models.RequestPending).
+			Update("status", models.RequestExpired).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error expiring requests"})
 			return
 		}
 	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit error"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Book copies removed successfully"})
 }
 
-// UpdateBook updates book details dynamically.
+// UpdateBookRequest defines the editable fields of a book. Title, Authors,
+// Publisher and Version belong to the shared edition, so a correction applies
+// to every library holding the ISBN; ShelfLocation belongs to the admin's own
+// holding. Omitted fields keep their current value. Copy counts change only
+// through AddBook and RemoveBook, and the ISBN and library cannot be changed.
+type UpdateBookRequest struct {
+	Title         *string `json:"Title" binding:"omitempty,min=1,max=255"`
+	Authors       *string `json:"Authors" binding:"omitempty,min=1,max=255"`
+	Publisher     *string `json:"Publisher" binding:"omitempty,max=255"`
+	Version       *string `json:"Version" binding:"omitempty,max=100"`
+	ShelfLocation *string `json:"ShelfLocation" binding:"omitempty,max=100"`
+}
+
+// updatableBookFields are the JSON keys of UpdateBookRequest.
+var updatableBookFields = []string{"Title", "Authors", "Publisher", "Version", "ShelfLocation"}
+
+// isUpdatableBookField reports whether key names an editable book field. Keys
+// match case-insensitively, as encoding/json matches them to struct fields.
+func isUpdatableBookField(key string) bool {
+	for _, field := range updatableBookFields {
+		if strings.EqualFold(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateBook updates a book held by the admin's library and returns the
+// updated book with its edition.
 func UpdateBook(c *gin.Context) {
-	isbn := c.Param("isbn")
+	isbn, ok := parseISBN(c, c.Param("isbn"))
+	if !ok {
+		return
+	}
 	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
 	libID := user.LibID
 
-	var updateData map[string]interface{}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	// The body's keys are checked against the editable fields first, since
+	// decoding into the typed request would silently drop any others.
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
-	if len(updateData) == 0 {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	for key := range fields {
+		if !isUpdatableBookField(key) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only Title, Authors, Publisher, Version and ShelfLocation can be updated"})
+			return
+		}
+	}
+	var req UpdateBookRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.Title == nil && req.Authors == nil && req.Publisher == nil && req.Version == nil && req.ShelfLocation == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No update fields provided"})
 		return
 	}
-	if err := config.DB.Model(&models.Book{}).Where("isbn = ? AND lib_id = ?", isbn, libID).Updates(updateData).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating book"})
+	for _, value := range []*string{req.Title, req.Authors, req.Publisher, req.Version, req.ShelfLocation} {
+		if value != nil {
+			*value = strings.TrimSpace(*value)
+		}
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title and Authors cannot be empty and fields must not exceed their maximum length"})
+		return
+	}
+
+	var book models.Book
+	if err := config.DB.Where("isbn = ? AND lib_id = ?", isbn, libID).Preload("Edition").First(&book).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+	editionUpdates := map[string]interface{}{}
+	if req.Title != nil {
+		book.Edition.Title = *req.Title
+		editionUpdates["title"] = book.Edition.Title
+	}
+	if req.Authors != nil {
+		book.Edition.Authors = *req.Authors
+		editionUpdates["authors"] = book.Edition.Authors
+	}
+	if req.Publisher != nil {
+		book.Edition.Publisher = *req.Publisher
+		editionUpdates["publisher"] = book.Edition.Publisher
+	}
+	if req.Version != nil {
+		book.Edition.Version = *req.Version
+		editionUpdates["version"] = book.Edition.Version
+	}
+
+	tx := config.DB.Begin()
+	if len(editionUpdates) > 0 {
+		if err := tx.Model(&models.Edition{}).Where("isbn = ?", book.ISBN).Updates(editionUpdates).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating edition"})
+			return
+		}
+	}
+	if req.ShelfLocation != nil {
+		book.ShelfLocation = *req.ShelfLocation
+		if err := tx.Model(&models.Book{}).Where("isbn = ? AND lib_id = ?", book.ISBN, libID).
+			Update("shelf_location", book.ShelfLocation).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating book"})
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit error"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Book details updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Book details updated successfully", "book": book})
 }
 
 // ListIssueRequests lists all issue requests for the library.
@@ -240,20 +492,63 @@ func ListIssueRequests(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"requests": requests})
 }*/
+// requestSorts are the sort keys of ListIssueRequests.
+var requestSorts = map[string]string{
+	"requested": "request_events.request_date",
+}
+
 func ListIssueRequests(c *gin.Context) {
 	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
 	libID := user.LibID
+	page, pageSize, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	// The queue is worked oldest first.
+	order, ok := parseSort(c, requestSorts, "requested", "request_events.id ASC")
+	if !ok {
+		return
+	}
 
+	// Pending requests are listed by default; ?status=all returns the full history.
+	status := c.DefaultQuery("status", models.RequestPending)
+	if status != "all" && !validRequestStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status filter"})
+		return
+	}
+
+	query := config.DB.Model(&models.RequestEvent{}).Scopes(requestsInLibrary(libID))
+	if status != "all" {
+		query = query.Where("request_events.status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching requests"})
+		return
+	}
 	var requests []models.RequestEvent
-	// Use a join to filter requests for this library with no approval_date (i.e., pending)
-	err := config.DB.Joins("JOIN books ON books.isbn = request_events.book_id").
-		Where("books.lib_id = ? AND request_events.approval_date IS NULL", libID).
-		Find(&requests).Error
-	if err != nil {
+	if err := paginate(query, page, pageSize).Order(order).Find(&requests).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching requests"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"requests": requests})
+	c.JSON(http.StatusOK, gin.H{"requests": requests, "page": page, "pageSize": pageSize, "total": total,
+		"next": nextPage(c, page, pageSize, total)})
+}
+
+// validRequestStatus reports whether status is one of the RequestEvent statuses.
+func validRequestStatus(status string) bool {
+	switch status {
+	case models.RequestPending, models.RequestApproved, models.RequestRejected,
+		models.RequestCancelled, models.RequestExpired:
+		return true
+	}
+	return false
+}
+
+// lockForUpdate makes the next query lock the rows it reads until the
+// transaction ends.
+func lockForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
 }
 
 func ApproveIssueRequest(c *gin.Context) {
@@ -268,37 +563,141 @@ func ApproveIssueRequest(c *gin.Context) {
 
 	tx := config.DB.Begin()
 
-	var reqEvent models.RequestEvent
-	if err := tx.Where("id = ?", reqID).First(&reqEvent).Error; err != nil {
+	// The request, book and reader rows are locked until commit so concurrent
+	// approvals are serialised: the same request cannot be approved twice, the
+	// last copy cannot be issued twice and a reader's loan limits hold.
+	reqEvent, err := findLibraryRequest(lockForUpdate(tx), libID, reqID)
+	if err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
 		return
 	}
 	// Prevent processing an already approved or rejected request.
-	if reqEvent.ApprovalDate != nil {
+	if reqEvent.Status != models.RequestPending {
 		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
 		return
 	}
 
+	// A return request closes the reader's open issue instead of issuing a copy.
+	if reqEvent.RequestType == "ReturnRequest" {
+		var issue models.IssueRegistry
+		if err := lockForUpdate(tx).Where("isbn = ? AND reader_id = ? AND issue_status = ?", reqEvent.BookID, reqEvent.ReaderID, "Issued").
+			First(&issue).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No active issue found for this return request"})
+			return
+		}
+		if err := returnIssue(tx, &issue, libID, user.ID, ""); err != nil {
+			tx.Rollback()
+			if err == errAlreadyReturned {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Book already returned"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating issue record"})
+			return
+		}
+		now := time.Now()
+		if err := tx.Model(&reqEvent).Updates(models.RequestEvent{
+			ApprovalDate: &now,
+			ApproverID:   &user.ID,
+			Status:       models.RequestApproved,
+		}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating request"})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Return request approved and book returned"})
+		return
+	}
+
 	var book models.Book
-	if err := tx.Where("isbn = ? AND lib_id = ?", reqEvent.BookID, libID).First(&book).Error; err != nil {
+	if err := lockForUpdate(tx).Where("isbn = ? AND lib_id = ?", reqEvent.BookID, libID).First(&book).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking book availability"})
 		return
 	}
-	if book.AvailableCopies <= 0 {
+
+	// A reader collecting a ready hold takes the copy already reserved for them.
+	var hold models.Hold
+	holdErr := tx.Where("isbn = ? AND lib_id = ? AND reader_id = ? AND status = ?", reqEvent.BookID, libID, reqEvent.ReaderID, models.HoldReady).
+		First(&hold).Error
+	if holdErr != nil && holdErr != gorm.ErrRecordNotFound {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking holds"})
+		return
+	}
+	hasHold := holdErr == nil
+	if !hasHold && book.AvailableCopies <= 0 {
 		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Book not available for issue"})
 		return
 	}
 
-	// Check if the user already has an active issue for the same book.
-	var activeIssue models.IssueRegistry
-	if err := tx.Where("isbn = ? AND reader_id = ? AND issue_status = ?", reqEvent.BookID, reqEvent.ReaderID, "Issued").
-		First(&activeIssue).Error; err == nil {
+	var reader models.User
+	if err := lockForUpdate(tx).Select("id").Where("id = ?", reqEvent.ReaderID).First(&reader).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User already has an active issue for this book"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading reader"})
+		return
+	}
+
+	policy, err := loadCirculationPolicy(tx, libID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading circulation policy"})
+		return
+	}
+	// Enforce the library's loan limits for the requesting reader.
+	violation, err := checkLoanPolicy(tx, policy, reqEvent.ReaderID, reqEvent.BookID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking circulation policy"})
+		return
+	}
+	if violation != "" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": violation})
+		return
+	}
+
+	// Hand out the copy reserved for the hold, the copy the admin scanned, or
+	// the first available one.
+	var bookCopy models.BookCopy
+	expectedStatus := models.CopyAvailable
+	if hasHold {
+		expectedStatus = models.CopyOnHold
+		bookCopy, err = findCopy(tx, hold.CopyID, book.ISBN, libID, models.CopyOnHold)
+	} else if barcode := c.Query("barcode"); barcode != "" {
+		err = tx.Where("barcode = ? AND isbn = ? AND lib_id = ? AND status = ?", barcode, book.ISBN, libID, models.CopyAvailable).
+			First(&bookCopy).Error
+	} else {
+		bookCopy, err = findCopy(tx, nil, book.ISBN, libID, models.CopyAvailable)
+	}
+	if err == gorm.ErrRecordNotFound {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Book not available for issue"})
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking book availability"})
+		return
+	}
+	res := tx.Model(&models.BookCopy{}).
+		Where("id = ? AND status = ?", bookCopy.ID, expectedStatus).
+		Update("status", models.CopyIssued)
+	if res.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating book inventory"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Copy was issued concurrently, please retry"})
 		return
 	}
 
@@ -306,28 +705,37 @@ func ApproveIssueRequest(c *gin.Context) {
 	if err := tx.Model(&reqEvent).Updates(models.RequestEvent{
 		ApprovalDate: &now,
 		ApproverID:   &user.ID,
+		Status:       models.RequestApproved,
 	}).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating request"})
 		return
 	}
 
-	expectedReturn := time.Now().AddDate(0, 0, 14)
+	expectedReturn := time.Now().AddDate(0, 0, policy.LoanPeriodDays)
 	issue := models.IssueRegistry{
 		ISBN:               reqEvent.BookID,
+		LibID:              libID,
 		ReaderID:           reqEvent.ReaderID,
 		IssueApproverID:    &user.ID,
 		IssueStatus:        "Issued",
 		IssueDate:          time.Now(),
 		ExpectedReturnDate: expectedReturn,
+		CopyID:             &bookCopy.ID,
 	}
 	if err := tx.Create(&issue).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating issue record"})
 		return
 	}
-	book.AvailableCopies -= 1
-	if err := tx.Save(&book).Error; err != nil {
+	if hasHold {
+		if err := tx.Model(&hold).Update("status", models.HoldFulfilled).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating hold"})
+			return
+		}
+	}
+	if err := syncCopyCounts(tx, book.ISBN, libID); err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating book inventory"})
 		return
@@ -376,6 +784,13 @@ func RejectIssueRequest(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"message": "Issue request rejected and removed"})
 }
 */
+// RejectRequest defines the optional payload for rejecting a request.
+type RejectRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RejectIssueRequest marks a pending request as rejected, keeping it with the
+// admin who rejected it and the reason given.
 func RejectIssueRequest(c *gin.Context) {
 	reqIDStr := c.Param("reqid")
 	reqID, err := strconv.Atoi(reqIDStr)
@@ -383,11 +798,150 @@ func RejectIssueRequest(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
 		return
 	}
+	var req RejectRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	reqEvent, err := findLibraryRequest(config.DB, user.LibID, reqID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+	if reqEvent.Status != models.RequestPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
+		return
+	}
+
+	// ApprovalDate records when the decision was made, whichever way it went.
+	now := time.Now()
+	res := config.DB.Model(&models.RequestEvent{}).
+		Where("id = ? AND status = ?", reqEvent.ID, models.RequestPending).
+		Updates(models.RequestEvent{
+			ApprovalDate:    &now,
+			ApproverID:      &user.ID,
+			Status:          models.RequestRejected,
+			RejectionReason: req.Reason,
+		})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error rejecting request"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Issue request rejected"})
+}
+
+// errAlreadyReturned is reported by returnIssue when the issue is no longer open.
+var errAlreadyReturned = errors.New("issue already returned")
+
+// returnIssue marks an issue record as returned, puts the copy back into
+// circulation and charges any overdue fine. A non-empty condition records the
+// state the copy came back in. It must be called inside the caller's
+// transaction.
+func returnIssue(tx *gorm.DB, issue *models.IssueRegistry, libID uint, returnerID uint, condition string) error {
+	now := time.Now()
+	// The status condition makes a concurrent second return affect no rows.
+	res := tx.Model(&models.IssueRegistry{}).
+		Where("id = ? AND issue_status = ?", issue.ID, "Issued").
+		Updates(map[string]interface{}{
+			"issue_status":       "Returned",
+			"return_date":        now,
+			"return_approver_id": returnerID,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errAlreadyReturned
+	}
+	bookCopy, err := findCopy(tx, issue.CopyID, issue.ISBN, libID, models.CopyIssued)
+	if err != nil {
+		return err
+	}
+	if condition != "" {
+		if err := tx.Model(&bookCopy).Update("condition", condition).Error; err != nil {
+			return err
+		}
+	}
+	if err := releaseCopy(tx, bookCopy); err != nil {
+		return err
+	}
+	if err := chargeOverdueFine(tx, *issue, libID, now, returnerID); err != nil {
+		return err
+	}
+	issue.IssueStatus = "Returned"
+	issue.ReturnDate = &now
+	issue.ReturnApproverID = &returnerID
+	return nil
+}
+
+// ReturnBookRequest optionally records the condition of the returned copy.
+type ReturnBookRequest struct {
+	Condition string `json:"Condition"`
+}
+
+// ReturnBook closes an issued book's record and restores the copy to inventory.
+func ReturnBook(c *gin.Context) {
+	issueID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return
+	}
+	var req ReturnBookRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+	libID := user.LibID
+
+	tx := config.DB.Begin()
+
+	// Only books held by the admin's own library can be returned here.
+	issue, err := findLibraryIssue(tx, libID, issueID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue record not found"})
+		return
+	}
+	if issue.IssueStatus != "Issued" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Book already returned"})
+		return
+	}
 
-	// Use Unscoped deletion to permanently remove the record.
-	if err := config.DB.Unscoped().Delete(&models.RequestEvent{}, reqID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error deleting request"})
+	if err := returnIssue(tx, &issue, libID, user.ID, req.Condition); err != nil {
+		tx.Rollback()
+		if err == errAlreadyReturned {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Book already returned"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating issue record"})
+		return
+	}
+
+	// A pending return request from the reader is settled by this return.
+	now := time.Now()
+	if err := tx.Model(&models.RequestEvent{}).
+		Where("book_id = ? AND reader_id = ? AND request_type = ? AND status = ?", issue.ISBN, issue.ReaderID, "ReturnRequest", models.RequestPending).
+		Updates(models.RequestEvent{ApprovalDate: &now, ApproverID: &user.ID, Status: models.RequestApproved}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating return request"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit error"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Issue request rejected and deleted"})
+	c.JSON(http.StatusOK, gin.H{"message": "Book returned successfully", "issue": issue})
 }
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"sort"
+	"time"
+
+	"lms/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// bookAvailability tells a reader when a book can be borrowed. Dates are
+// formatted as 2006-01-02 and are null when unknown.
+type bookAvailability struct {
+	Available bool `json:"available"`
+	// NextReturnDate is when the earliest open loan of the book is due.
+	NextReturnDate *string `json:"next_return_date"`
+	// HoldQueueLength is the number of readers waiting for a copy.
+	HoldQueueLength int64 `json:"hold_queue_length"`
+	// EstimatedAvailableDate is when a reader joining the queue now can
+	// expect a copy, if no copy is available.
+	EstimatedAvailableDate *string `json:"estimated_available_date"`
+}
+
+// loadAvailability computes the availability of a page of the library's
+// books. Only open loans and waiting holds in the library count. It runs at
+// most three queries however many books there are.
+func loadAvailability(db *gorm.DB, libID uint, books []models.Book) (map[string]bookAvailability, error) {
+	availability := make(map[string]bookAvailability, len(books))
+	if len(books) == 0 {
+		return availability, nil
+	}
+	isbns := make([]string, len(books))
+	var unavailable []string
+	for i, book := range books {
+		isbns[i] = book.ISBN
+		if book.AvailableCopies <= 0 {
+			unavailable = append(unavailable, book.ISBN)
+		}
+	}
+
+	var queues []struct {
+		ISBN    string
+		Waiting int64
+	}
+	if err := db.Model(&models.Hold{}).Select("isbn, count(*) AS waiting").
+		Where("lib_id = ? AND isbn IN ? AND status = ?", libID, isbns, models.HoldWaiting).
+		Group("isbn").Scan(&queues).Error; err != nil {
+		return nil, err
+	}
+	waiting := make(map[string]int64, len(queues))
+	for _, queue := range queues {
+		waiting[queue.ISBN] = queue.Waiting
+	}
+
+	dueDates := map[string][]time.Time{}
+	var policy models.CirculationPolicy
+	if len(unavailable) > 0 {
+		var loans []models.IssueRegistry
+		if err := db.Select("isbn", "expected_return_date").
+			Where("lib_id = ? AND isbn IN ? AND issue_status = ?", libID, unavailable, "Issued").
+			Find(&loans).Error; err != nil {
+			return nil, err
+		}
+		for _, loan := range loans {
+			dueDates[loan.ISBN] = append(dueDates[loan.ISBN], loan.ExpectedReturnDate)
+		}
+		if len(loans) > 0 {
+			var err error
+			if policy, err = loadCirculationPolicy(db, libID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, book := range books {
+		entry := bookAvailability{Available: book.AvailableCopies > 0, HoldQueueLength: waiting[book.ISBN]}
+		if due := dueDates[book.ISBN]; len(due) > 0 {
+			sort.Slice(due, func(i, j int) bool { return due[i].Before(due[j]) })
+			entry.NextReturnDate = formatDate(due[0])
+			if !entry.Available {
+				entry.EstimatedAvailableDate = formatDate(estimateAvailableDate(due, entry.HoldQueueLength, policy.LoanPeriodDays, now))
+			}
+		}
+		availability[book.ISBN] = entry
+	}
+	return availability, nil
+}
+
+// estimateAvailableDate estimates when a copy reaches a reader with ahead
+// readers waiting before them, given the sorted due dates of the open loans.
+// Each returned copy goes to the next reader in the queue, who keeps it for
+// a full loan period. Overdue loans are taken to come back today.
+func estimateAvailableDate(due []time.Time, ahead int64, loanPeriodDays int, now time.Time) time.Time {
+	rounds := int(ahead) / len(due)
+	date := due[int(ahead)%len(due)]
+	if date.Before(now) {
+		date = now
+	}
+	return date.AddDate(0, 0, rounds*loanPeriodDays)
+}
+
+func formatDate(t time.Time) *string {
+	s := t.Format("2006-01-02")
+	return &s
+}
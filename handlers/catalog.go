@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// editionDocument is the full-text document of an edition: its title, then
+// authors, then publisher by weight. migrations/0006_edition_search.sql
+// indexes this exact expression, so it must be kept in step with it.
+const editionDocument = "(setweight(to_tsvector('english', coalesce(editions.title, '')), 'A') || " +
+	"setweight(to_tsvector('english', coalesce(editions.authors, '')), 'B') || " +
+	"setweight(to_tsvector('english', coalesce(editions.publisher, '')), 'C'))"
+
+// maxSuggestions caps the "did you mean" suggestions of an empty search.
+const maxSuggestions = 5
+
+// searchQuery turns free text into a tsquery that requires every word, each
+// as a prefix, so "kern prog" matches "Kernighan" and "Programming". Anything
+// other than letters and digits separates words. It returns "" when the text
+// has no words.
+func searchQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// catalogSearch holds the catalog search parameters. q is searched across
+// title, authors and publisher, while title, author and publisher each narrow
+// their own field. With fuzzy=true, q, title and author match by pg_trgm word
+// similarity instead, so misspellings still find near matches. selected holds
+// the chosen values of each of the catalogFacets.
+type catalogSearch struct {
+	text      string
+	query     string
+	title     string
+	author    string
+	publisher string
+	fuzzy     bool
+	selected  map[string][]string
+}
+
+// parseCatalogSearch reads the search parameters of the request.
+func parseCatalogSearch(c *gin.Context) (catalogSearch, error) {
+	fuzzy, err := strconv.ParseBool(c.DefaultQuery("fuzzy", "false"))
+	if err != nil {
+		return catalogSearch{}, errors.New("fuzzy must be true or false")
+	}
+	selected, err := parseFacetSelections(c.QueryArray)
+	if err != nil {
+		return catalogSearch{}, err
+	}
+	text := strings.TrimSpace(c.Query("q"))
+	return catalogSearch{
+		text:      text,
+		query:     searchQuery(text),
+		title:     strings.TrimSpace(c.Query("title")),
+		author:    strings.TrimSpace(c.Query("author")),
+		publisher: strings.TrimSpace(c.Query("publisher")),
+		fuzzy:     fuzzy,
+		selected:  selected,
+	}, nil
+}
+
+// filter applies the search to a books query joined with editions.
+// SearchBooks and ExportBooks share it so an export matches what readers find.
+func (s catalogSearch) filter(db *gorm.DB) *gorm.DB {
+	return s.filterExcept("")(db)
+}
+
+// filterExcept is filter without the selection of the named facet.
+func (s catalogSearch) filterExcept(except string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if s.fuzzy {
+			if s.text != "" {
+				db = db.Where("editions.title %> ? OR editions.authors %> ?", s.text, s.text)
+			}
+			if s.title != "" {
+				db = db.Where("editions.title %> ?", s.title)
+			}
+			if s.author != "" {
+				db = db.Where("editions.authors %> ?", s.author)
+			}
+		} else {
+			if s.query != "" {
+				db = db.Where(editionDocument+" @@ to_tsquery('english', ?)", s.query)
+			}
+			if s.title != "" {
+				db = db.Where("editions.title ILIKE ?", "%"+s.title+"%")
+			}
+			if s.author != "" {
+				db = db.Where("editions.authors ILIKE ?", "%"+s.author+"%")
+			}
+		}
+		if s.publisher != "" {
+			db = db.Where("editions.publisher ILIKE ?", "%"+s.publisher+"%")
+		}
+		for _, facet := range catalogFacets {
+			if values := s.selected[facet.name]; len(values) > 0 && facet.name != except {
+				db = db.Where(facet.filter, values)
+			}
+		}
+		return db
+	}
+}
+
+// ranked reports whether the search has terms to rank results by.
+func (s catalogSearch) ranked() bool {
+	if s.fuzzy {
+		return s.text != "" || s.title != "" || s.author != ""
+	}
+	return s.query != ""
+}
+
+// rank orders a search best match first: by similarity in fuzzy mode,
+// otherwise by full-text relevance to q. Without a term to rank by the query
+// is left as it is.
+func (s catalogSearch) rank(db *gorm.DB) *gorm.DB {
+	var scores []string
+	var vars []interface{}
+	if s.fuzzy {
+		if s.text != "" {
+			scores = append(scores, "greatest(word_similarity(?, editions.title), word_similarity(?, editions.authors))")
+			vars = append(vars, s.text, s.text)
+		}
+		if s.title != "" {
+			scores = append(scores, "word_similarity(?, editions.title)")
+			vars = append(vars, s.title)
+		}
+		if s.author != "" {
+			scores = append(scores, "word_similarity(?, editions.authors)")
+			vars = append(vars, s.author)
+		}
+	} else if s.query != "" {
+		scores = append(scores, "ts_rank("+editionDocument+", to_tsquery('english', ?))")
+		vars = append(vars, s.query)
+	}
+	if len(scores) == 0 {
+		return db
+	}
+	return db.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                "(" + strings.Join(scores, " + ") + ") DESC, books.isbn",
+		Vars:               vars,
+		WithoutParentheses: true,
+	}})
+}
+
+// catalogSuggestion proposes a value for a search parameter that would find
+// books in the library.
+type catalogSuggestion struct {
+	Param string `json:"param"`
+	Value string `json:"value"`
+	score float64
+}
+
+// suggestions finds "did you mean" alternatives for the search's q, title and
+// author among the titles and authors held by the library, the most similar
+// first.
+func (s catalogSearch) suggestions(db *gorm.DB, libID uint) ([]catalogSuggestion, error) {
+	type candidate struct{ param, term, column string }
+	var candidates []candidate
+	if s.text != "" {
+		candidates = append(candidates, candidate{"q", s.text, "title"}, candidate{"q", s.text, "authors"})
+	}
+	if s.title != "" {
+		candidates = append(candidates, candidate{"title", s.title, "title"})
+	}
+	if s.author != "" {
+		candidates = append(candidates, candidate{"author", s.author, "authors"})
+	}
+
+	suggestions := []catalogSuggestion{}
+	seen := map[catalogSuggestion]bool{}
+	for _, cand := range candidates {
+		var rows []struct {
+			Value string
+			Score float64
+		}
+		column := "editions." + cand.column
+		if err := db.Table("books").Joins("JOIN editions ON editions.isbn = books.isbn").
+			Select("DISTINCT "+column+" AS value, word_similarity(?, "+column+") AS score", cand.term).
+			Where("books.lib_id = ? AND "+column+" %> ?", libID, cand.term).
+			Order("score DESC").Limit(maxSuggestions).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			key := catalogSuggestion{Param: cand.param, Value: row.Value}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			key.score = row.Score
+			suggestions = append(suggestions, key)
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].score > suggestions[j].score })
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"lms/backend/config"
+	"lms/backend/middlewares"
+	"lms/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CopyInput describes a physical copy supplied when adding a book.
+type CopyInput struct {
+	Barcode       string `json:"Barcode"`
+	Condition     string `json:"Condition"`
+	ShelfLocation string `json:"ShelfLocation"`
+}
+
+// UpdateCopyRequest defines the payload for editing a copy. Omitted fields
+// keep their current value.
+type UpdateCopyRequest struct {
+	Condition     *string `json:"Condition" binding:"omitempty,min=1"`
+	ShelfLocation *string `json:"ShelfLocation"`
+}
+
+// newBarcode generates a barcode for copies added without one.
+func newBarcode() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+// createCopies adds count copies of a book, using the supplied items when
+// given, and returns the created copies.
+func createCopies(tx *gorm.DB, isbn string, libID uint, count int, items []CopyInput) ([]models.BookCopy, error) {
+	copies := make([]models.BookCopy, 0, count)
+	for i := 0; i < count; i++ {
+		item := CopyInput{}
+		if i < len(items) {
+			item = items[i]
+		}
+		if item.Barcode == "" {
+			barcode, err := newBarcode()
+			if err != nil {
+				return nil, err
+			}
+			item.Barcode = barcode
+		}
+		if item.Condition == "" {
+			item.Condition = "Good"
+		}
+		copies = append(copies, models.BookCopy{
+			ISBN:          isbn,
+			LibID:         libID,
+			Barcode:       item.Barcode,
+			Condition:     item.Condition,
+			ShelfLocation: item.ShelfLocation,
+			Status:        models.CopyAvailable,
+		})
+	}
+	if err := tx.Create(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+// syncCopyCounts recomputes a book's total and available counts from its copies.
+func syncCopyCounts(tx *gorm.DB, isbn string, libID uint) error {
+	return tx.Exec(`UPDATE books SET
+		total_copies = (SELECT COUNT(*) FROM book_copies c
+			WHERE c.isbn = books.isbn AND c.lib_id = books.lib_id AND c.status <> ? AND c.deleted_at IS NULL),
+		available_copies = (SELECT COUNT(*) FROM book_copies c
+			WHERE c.isbn = books.isbn AND c.lib_id = books.lib_id AND c.status = ? AND c.deleted_at IS NULL)
+		WHERE isbn = ? AND lib_id = ?`, models.CopyWithdrawn, models.CopyAvailable, isbn, libID).Error
+}
+
+// findCopy loads the copy with the given ID. Records created before copies
+// were tracked have no copy ID, so any copy of the book in the given status
+// stands in for it.
+func findCopy(tx *gorm.DB, copyID *uint, isbn string, libID uint, status string) (models.BookCopy, error) {
+	var bookCopy models.BookCopy
+	if copyID != nil {
+		err := tx.Where("id = ?", *copyID).First(&bookCopy).Error
+		return bookCopy, err
+	}
+	err := tx.Where("isbn = ? AND lib_id = ? AND status = ?", isbn, libID, status).
+		Order("id ASC").First(&bookCopy).Error
+	return bookCopy, err
+}
+
+// releaseCopy puts a copy back into circulation. The copy goes to the head of
+// the hold queue if anyone is waiting, otherwise it becomes available again.
+func releaseCopy(tx *gorm.DB, bookCopy models.BookCopy) error {
+	promoted, err := promoteHolds(tx, bookCopy.ISBN, bookCopy.LibID, []models.BookCopy{bookCopy})
+	if err != nil {
+		return err
+	}
+	if promoted == 0 {
+		if err := tx.Model(&bookCopy).Update("status", models.CopyAvailable).Error; err != nil {
+			return err
+		}
+	}
+	return syncCopyCounts(tx, bookCopy.ISBN, bookCopy.LibID)
+}
+
+// ListBookCopies lists the copies of a book in the admin's library.
+func ListBookCopies(c *gin.Context) {
+	isbn, ok := parseISBN(c, c.Param("isbn"))
+	if !ok {
+		return
+	}
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	var copies []models.BookCopy
+	if err := config.DB.Where("isbn = ? AND lib_id = ?", isbn, user.LibID).
+		Order("id ASC").Find(&copies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching copies"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"copies": copies})
+}
+
+// UpdateBookCopy changes the condition or shelf location of a copy.
+func UpdateBookCopy(c *gin.Context) {
+	barcode := c.Param("barcode")
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	var req UpdateCopyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	var bookCopy models.BookCopy
+	if err := config.DB.Where("barcode = ? AND lib_id = ?", barcode, user.LibID).First(&bookCopy).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found"})
+		return
+	}
+	// Only the requested columns are written, so a concurrent change of the
+	// copy's status is not overwritten by the one read here.
+	changes := map[string]interface{}{}
+	if req.Condition != nil {
+		changes["condition"] = *req.Condition
+	}
+	if req.ShelfLocation != nil {
+		changes["shelf_location"] = *req.ShelfLocation
+	}
+	if len(changes) > 0 {
+		if err := config.DB.Model(&bookCopy).Updates(changes).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating copy"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Copy updated successfully", "copy": bookCopy})
+}
@@ -15,6 +15,7 @@ type CreateReaderRequest struct {
 	Email         string `json:"email" binding:"required,email"`
 	ContactNumber string `json:"contactNumber"`
 	LibID         uint   `json:"libID" binding:"required"`
+	Password      string `json:"password" binding:"required,min=8"`
 }
 
 func CreateReader(c *gin.Context) {
@@ -30,6 +31,12 @@ func CreateReader(c *gin.Context) {
 		return
 	}
 
+	passwordHash, err := hashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+		return
+	}
+
 	// Create a new reader with the "Reader" role.
 	reader := models.User{
 		Name:          req.Name,
@@ -37,6 +44,7 @@ func CreateReader(c *gin.Context) {
 		ContactNumber: req.ContactNumber,
 		Role:          "Reader",
 		LibID:         req.LibID,
+		PasswordHash:  passwordHash,
 	}
 
 	if err := config.DB.Create(&reader).Error; err != nil {
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"lms/backend/config"
+	"lms/backend/marc"
+	"lms/backend/middlewares"
+	"lms/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// Tabular export formats, in addition to the MARC formats.
+const (
+	formatJSONL = "jsonl"
+	formatXLSX  = "xlsx"
+)
+
+// exportBatchSize is how many books are loaded per query while exporting.
+const exportBatchSize = 500
+
+// exportRow is one book of the library with its copies in stock.
+type exportRow struct {
+	book   models.Book
+	copies []models.BookCopy
+}
+
+// countCopies counts the row's copies in the given status.
+func (r exportRow) countCopies(status string) int {
+	n := 0
+	for _, bookCopy := range r.copies {
+		if bookCopy.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// exportColumn is a column of the tabular exports.
+type exportColumn struct {
+	name  string
+	value func(exportRow) interface{}
+}
+
+// exportColumns lists the available columns in their default order.
+var exportColumns = []exportColumn{
+	{"isbn", func(r exportRow) interface{} { return r.book.ISBN }},
+	{"title", func(r exportRow) interface{} { return r.book.Edition.Title }},
+	{"authors", func(r exportRow) interface{} { return r.book.Edition.Authors }},
+	{"publisher", func(r exportRow) interface{} { return r.book.Edition.Publisher }},
+	{"version", func(r exportRow) interface{} { return r.book.Edition.Version }},
+	{"shelf_location", func(r exportRow) interface{} { return r.book.ShelfLocation }},
+	{"total_copies", func(r exportRow) interface{} { return r.book.TotalCopies }},
+	{"available_copies", func(r exportRow) interface{} { return r.book.AvailableCopies }},
+	{"on_loan", func(r exportRow) interface{} { return r.countCopies(models.CopyIssued) }},
+	{"on_hold", func(r exportRow) interface{} { return r.countCopies(models.CopyOnHold) }},
+	{"availability", func(r exportRow) interface{} {
+		if r.book.AvailableCopies > 0 {
+			return "Available"
+		}
+		return "Not available"
+	}},
+	{"barcodes", func(r exportRow) interface{} {
+		barcodes := make([]string, len(r.copies))
+		for i, bookCopy := range r.copies {
+			barcodes[i] = bookCopy.Barcode
+		}
+		return strings.Join(barcodes, "; ")
+	}},
+}
+
+// selectColumns resolves the comma-separated columns parameter. An empty
+// parameter selects every column.
+func selectColumns(param string) ([]exportColumn, error) {
+	if param == "" {
+		return exportColumns, nil
+	}
+	var columns []exportColumn
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, column := range exportColumns {
+			if column.name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown export column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// eachBookBatch calls fn with the library's books and their editions in ISBN
+// order, exportBatchSize at a time, so an export never holds the whole
+// catalog in memory. scopes narrow the books query, which is joined with
+// editions.
+func eachBookBatch(db *gorm.DB, libID uint, scopes []func(*gorm.DB) *gorm.DB, fn func([]models.Book) error) error {
+	lastISBN := ""
+	for {
+		var books []models.Book
+		if err := db.Joins("JOIN editions ON editions.isbn = books.isbn").Preload("Edition").
+			Where("books.lib_id = ? AND books.isbn > ?", libID, lastISBN).Scopes(scopes...).
+			Order("books.isbn ASC").Limit(exportBatchSize).Find(&books).Error; err != nil {
+			return err
+		}
+		if len(books) == 0 {
+			return nil
+		}
+		if err := fn(books); err != nil {
+			return err
+		}
+		if len(books) < exportBatchSize {
+			return nil
+		}
+		lastISBN = books[len(books)-1].ISBN
+	}
+}
+
+// copiesByISBN loads the copies in stock for a batch of books, keyed by ISBN.
+func copiesByISBN(db *gorm.DB, libID uint, books []models.Book) (map[string][]models.BookCopy, error) {
+	isbns := make([]string, len(books))
+	for i, book := range books {
+		isbns[i] = book.ISBN
+	}
+	var copies []models.BookCopy
+	if err := db.Where("lib_id = ? AND isbn IN ? AND status <> ?", libID, isbns, models.CopyWithdrawn).
+		Order("id ASC").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	byISBN := make(map[string][]models.BookCopy, len(books))
+	for _, bookCopy := range copies {
+		byISBN[bookCopy.ISBN] = append(byISBN[bookCopy.ISBN], bookCopy)
+	}
+	return byISBN, nil
+}
+
+// marcBook describes a holding and its copies for the MARC exporter. Copies
+// without a shelf location of their own are shelved with the book.
+func marcBook(book models.Book, copies []models.BookCopy) marc.Book {
+	record := marc.Book{
+		ISBN:      book.ISBN,
+		Title:     book.Edition.Title,
+		Authors:   book.Edition.Authors,
+		Publisher: book.Edition.Publisher,
+		Version:   book.Edition.Version,
+	}
+	for _, bookCopy := range copies {
+		location := bookCopy.ShelfLocation
+		if location == "" {
+			location = book.ShelfLocation
+		}
+		record.Items = append(record.Items, marc.Item{Barcode: bookCopy.Barcode, ShelfLocation: location})
+	}
+	return record
+}
+
+// exportWriter writes an export in one format. Flush is called after every
+// batch so streaming formats reach the client as they are produced. Streaming
+// reports whether the format writes anything before Close; the response is
+// only flushed for those, so a format that does not can still answer an error
+// with a 500 until it is complete.
+type exportWriter interface {
+	Write(row exportRow) error
+	Flush() error
+	Close() error
+	Streaming() bool
+}
+
+type marcExportWriter struct {
+	write func(*marc.Record) error
+	close func() error
+}
+
+func (w *marcExportWriter) Write(row exportRow) error {
+	return w.write(marc.RecordFromBook(marcBook(row.book, row.copies)))
+}
+func (w *marcExportWriter) Flush() error    { return nil }
+func (w *marcExportWriter) Close() error    { return w.close() }
+func (w *marcExportWriter) Streaming() bool { return true }
+
+type csvExportWriter struct {
+	w       *csv.Writer
+	columns []exportColumn
+}
+
+func newCSVExportWriter(out io.Writer, columns []exportColumn) (*csvExportWriter, error) {
+	w := &csvExportWriter{w: csv.NewWriter(out), columns: columns}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	return w, w.w.Write(header)
+}
+
+func (w *csvExportWriter) Write(row exportRow) error {
+	record := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		record[i] = fmt.Sprint(column.value(row))
+	}
+	return w.w.Write(record)
+}
+func (w *csvExportWriter) Flush() error    { w.w.Flush(); return w.w.Error() }
+func (w *csvExportWriter) Close() error    { return w.Flush() }
+func (w *csvExportWriter) Streaming() bool { return true }
+
+type jsonlExportWriter struct {
+	e       *json.Encoder
+	columns []exportColumn
+}
+
+func (w *jsonlExportWriter) Write(row exportRow) error {
+	object := make(map[string]interface{}, len(w.columns))
+	for _, column := range w.columns {
+		object[column.name] = column.value(row)
+	}
+	return w.e.Encode(object)
+}
+func (w *jsonlExportWriter) Flush() error    { return nil }
+func (w *jsonlExportWriter) Close() error    { return nil }
+func (w *jsonlExportWriter) Streaming() bool { return true }
+
+// xlsxExportWriter builds the workbook with excelize's stream writer, which
+// keeps rows on disk rather than in memory. The file can only be sent once it
+// is complete, on Close. Whether or not the export succeeds, the workbook's
+// temporary files are removed by cleanup.
+type xlsxExportWriter struct {
+	out     io.Writer
+	file    *excelize.File
+	sheet   *excelize.StreamWriter
+	columns []exportColumn
+	row     int
+}
+
+func newXLSXExportWriter(out io.Writer, columns []exportColumn) (*xlsxExportWriter, error) {
+	file := excelize.NewFile()
+	sheet, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w := &xlsxExportWriter{out: out, file: file, sheet: sheet, columns: columns, row: 1}
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := w.writeRow(header); err != nil {
+		w.cleanup()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *xlsxExportWriter) writeRow(values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	w.row++
+	return w.sheet.SetRow(cell, values)
+}
+
+func (w *xlsxExportWriter) Write(row exportRow) error {
+	values := make([]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		values[i] = column.value(row)
+	}
+	return w.writeRow(values)
+}
+func (w *xlsxExportWriter) Flush() error    { return nil }
+func (w *xlsxExportWriter) Streaming() bool { return false }
+func (w *xlsxExportWriter) Close() error {
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.file.Write(w.out)
+}
+
+func (w *xlsxExportWriter) cleanup() {
+	if err := w.file.Close(); err != nil {
+		log.Println("Error removing export temporary files:", err)
+	}
+}
+
+// ExportBooks streams the catalog of the admin's library: its books, their
+// copies in stock and availability. format selects csv (the default), jsonl,
+// xlsx, marc (binary MARC 21) or marcxml. The tabular formats take a
+// comma-separated columns parameter; MARC records always carry the full
+// record with an 852 holdings field per copy. The search parameters of
+// SearchBooks (q, title, author, publisher and fuzzy) filter the books.
+func ExportBooks(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	columns, err := selectColumns(c.Query("columns"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	search, err := parseCatalogSearch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var w exportWriter
+	switch c.DefaultQuery("format", formatCSV) {
+	case formatCSV:
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="catalog.csv"`)
+		w, err = newCSVExportWriter(c.Writer, columns)
+	case formatJSONL:
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="catalog.jsonl"`)
+		w = &jsonlExportWriter{e: json.NewEncoder(c.Writer), columns: columns}
+	case formatXLSX:
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Header("Content-Disposition", `attachment; filename="catalog.xlsx"`)
+		var xw *xlsxExportWriter
+		if xw, err = newXLSXExportWriter(c.Writer, columns); err == nil {
+			defer xw.cleanup()
+			w = xw
+		}
+	case formatMARC:
+		c.Header("Content-Type", "application/marc")
+		c.Header("Content-Disposition", `attachment; filename="catalog.mrc"`)
+		w = &marcExportWriter{write: marc.NewWriter(c.Writer).Write, close: func() error { return nil }}
+	case formatMARCXML:
+		c.Header("Content-Type", "application/marcxml+xml")
+		c.Header("Content-Disposition", `attachment; filename="catalog.xml"`)
+		xw := marc.NewXMLWriter(c.Writer)
+		w = &marcExportWriter{write: xw.Write, close: xw.Close}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, jsonl, xlsx, marc or marcxml"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+	if err == nil {
+		scopes := []func(*gorm.DB) *gorm.DB{search.filter}
+		err = eachBookBatch(config.DB, user.LibID, scopes, func(books []models.Book) error {
+			copies, err := copiesByISBN(config.DB, user.LibID, books)
+			if err != nil {
+				return err
+			}
+			for _, book := range books {
+				if err := w.Write(exportRow{book: book, copies: copies[book.ISBN]}); err != nil {
+					return err
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if w.Streaming() {
+				c.Writer.Flush()
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error exporting catalog"})
+			return
+		}
+		// The download has started, so all that is left is to cut it short.
+		log.Println("Error exporting catalog:", err)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// maxFacetValues caps how many values of each facet are counted, the most
+// common first.
+const maxFacetValues = 20
+
+// Availability facet values.
+const (
+	facetAvailable   = "available"
+	facetUnavailable = "unavailable"
+)
+
+// catalogFacet is a dimension search results can be counted and narrowed by.
+type catalogFacet struct {
+	// name keys the facet's counts in the SearchBooks response.
+	name string
+	// param is the repeatable query parameter that selects facet values.
+	param string
+	// value is the SQL expression of a book's value; join adds what it needs
+	// to the FROM clause.
+	value string
+	join  string
+	// filter keeps the books with one of the selected values, bound to ?.
+	filter string
+	// allowed lists the only values that may be selected, if it is fixed.
+	allowed []string
+}
+
+const availabilityValue = "CASE WHEN books.available_copies > 0 THEN '" + facetAvailable + "' ELSE '" + facetUnavailable + "' END"
+
+// catalogFacets are the facets of SearchBooks. An edition lists its authors
+// separated by commas, so a book counts once under each of them.
+var catalogFacets = []catalogFacet{
+	{
+		name:   "publisher",
+		param:  "facetPublisher",
+		value:  "editions.publisher",
+		filter: "editions.publisher IN ?",
+	},
+	{
+		name:   "author",
+		param:  "facetAuthor",
+		value:  "author",
+		join:   `CROSS JOIN LATERAL regexp_split_to_table(editions.authors, '\s*,\s*') AS author`,
+		filter: `EXISTS (SELECT 1 FROM regexp_split_to_table(editions.authors, '\s*,\s*') AS author WHERE author IN ?)`,
+	},
+	{
+		name:    "availability",
+		param:   "facetAvailability",
+		value:   availabilityValue,
+		filter:  availabilityValue + " IN ?",
+		allowed: []string{facetAvailable, facetUnavailable},
+	},
+	{
+		name:   "edition",
+		param:  "facetEdition",
+		value:  "editions.version",
+		filter: "editions.version IN ?",
+	},
+}
+
+// facetValue is the number of matching books with one value of a facet.
+type facetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// parseFacetSelections reads the selected values of each facet from query.
+func parseFacetSelections(query func(string) []string) (map[string][]string, error) {
+	selected := map[string][]string{}
+	for _, facet := range catalogFacets {
+		values := query(facet.param)
+		for _, value := range values {
+			if facet.allowed != nil && !contains(facet.allowed, value) {
+				return nil, fmt.Errorf("%s must be %s", facet.param, strings.Join(facet.allowed, " or "))
+			}
+		}
+		if len(values) > 0 {
+			selected[facet.name] = values
+		}
+	}
+	return selected, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// facets counts the library's books matching the search by each facet's
+// values. A facet's own selection is left out of its counts, so the other
+// values it could be widened to are still listed.
+func (s catalogSearch) facets(db *gorm.DB, libID uint) (map[string][]facetValue, error) {
+	counts := make(map[string][]facetValue, len(catalogFacets))
+	for _, facet := range catalogFacets {
+		query := db.Table("books").Joins("JOIN editions ON editions.isbn = books.isbn")
+		if facet.join != "" {
+			query = query.Joins(facet.join)
+		}
+		values := []facetValue{}
+		if err := query.Select(facet.value+" AS value, count(*) AS count").
+			Where("books.lib_id = ? AND coalesce("+facet.value+", '') <> ''", libID).
+			Scopes(s.filterExcept(facet.name)).
+			Group("value").Order("count DESC, value").Limit(maxFacetValues).
+			Scan(&values).Error; err != nil {
+			return nil, err
+		}
+		counts[facet.name] = values
+	}
+	return counts, nil
+}
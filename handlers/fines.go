@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"lms/backend/config"
+	"lms/backend/middlewares"
+	"lms/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// FineAdjustmentRequest defines the payload for recording a payment or waiver.
+type FineAdjustmentRequest struct {
+	Amount int64  `json:"amount" binding:"required,gt=0"`
+	Note   string `json:"note"`
+}
+
+// overdueFine returns the fine for a loan due at dueDate and returned (or
+// still open) at asOf. Only the days late beyond the grace period are charged.
+func overdueFine(policy models.CirculationPolicy, dueDate, asOf time.Time) int64 {
+	lateDays := int64(asOf.Sub(dueDate).Hours() / 24)
+	lateDays -= int64(policy.GraceDays)
+	if lateDays <= 0 {
+		return 0
+	}
+	return lateDays * policy.FinePerDay
+}
+
+// chargeOverdueFine records a charge for a late return. It must be called
+// inside the caller's transaction.
+func chargeOverdueFine(tx *gorm.DB, issue models.IssueRegistry, libID uint, returnedAt time.Time, recordedBy uint) error {
+	policy, err := loadCirculationPolicy(tx, libID)
+	if err != nil {
+		return err
+	}
+	amount := overdueFine(policy, issue.ExpectedReturnDate, returnedAt)
+	if amount == 0 {
+		return nil
+	}
+	entry := models.FineEntry{
+		ReaderID:     issue.ReaderID,
+		LibID:        libID,
+		IssueID:      &issue.ID,
+		Kind:         models.FineCharge,
+		Amount:       amount,
+		Note:         "Overdue return of " + issue.ISBN,
+		RecordedByID: &recordedBy,
+	}
+	return tx.Create(&entry).Error
+}
+
+// fineBalance returns the reader's outstanding balance in the library.
+func fineBalance(db *gorm.DB, readerID, libID uint) (int64, error) {
+	var balance int64
+	err := db.Model(&models.FineEntry{}).
+		Select("COALESCE(SUM(CASE WHEN kind = ? THEN amount ELSE -amount END), 0)", models.FineCharge).
+		Where("reader_id = ? AND lib_id = ?", readerID, libID).
+		Scan(&balance).Error
+	return balance, err
+}
+
+// fineStatement builds the ledger, balance and estimated fines on open loans
+// for a reader.
+func fineStatement(db *gorm.DB, readerID, libID uint) (gin.H, error) {
+	policy, err := loadCirculationPolicy(db, libID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []models.FineEntry
+	if err := db.Where("reader_id = ? AND lib_id = ?", readerID, libID).
+		Order("created_at DESC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	balance, err := fineBalance(db, readerID, libID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open loans are not charged until they are returned; show what they
+	// would cost if returned today.
+	var openLoans []models.IssueRegistry
+	if err := db.Where("reader_id = ? AND issue_status = ? AND expected_return_date < ?", readerID, "Issued", time.Now()).
+		Find(&openLoans).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	estimates := []gin.H{}
+	var estimatedTotal int64
+	for _, loan := range openLoans {
+		amount := overdueFine(policy, loan.ExpectedReturnDate, now)
+		if amount == 0 {
+			continue
+		}
+		estimatedTotal += amount
+		estimates = append(estimates, gin.H{
+			"issueId":            loan.ID,
+			"isbn":               loan.ISBN,
+			"expectedReturnDate": loan.ExpectedReturnDate,
+			"estimatedFine":      amount,
+		})
+	}
+
+	return gin.H{
+		"balance":        balance,
+		"entries":        entries,
+		"estimated":      estimates,
+		"estimatedTotal": estimatedTotal,
+	}, nil
+}
+
+// GetMyFines returns the signed-in reader's fines ledger.
+func GetMyFines(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	statement, err := fineStatement(config.DB, user.ID, user.LibID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching fines"})
+		return
+	}
+	c.JSON(http.StatusOK, statement)
+}
+
+// GetReaderFines returns the fines ledger of a reader in the admin's library.
+func GetReaderFines(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+	reader, ok := findLibraryReader(c, user.LibID)
+	if !ok {
+		return
+	}
+
+	statement, err := fineStatement(config.DB, reader.ID, user.LibID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching fines"})
+		return
+	}
+	c.JSON(http.StatusOK, statement)
+}
+
+// recordFineAdjustment adds a payment or waiver that reduces a reader's balance.
+func recordFineAdjustment(c *gin.Context, kind string) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+	var req FineAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be a positive number"})
+		return
+	}
+	reader, ok := findLibraryReader(c, user.LibID)
+	if !ok {
+		return
+	}
+
+	tx := config.DB.Begin()
+
+	// The reader row is locked until commit so concurrent payments and
+	// waivers are checked against the balance one at a time.
+	if err := lockForUpdate(tx).Select("id").Where("id = ?", reader.ID).First(&models.User{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading reader"})
+		return
+	}
+	balance, err := fineBalance(tx, reader.ID, user.LibID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching fines"})
+		return
+	}
+	if req.Amount > balance {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount exceeds the outstanding balance"})
+		return
+	}
+
+	entry := models.FineEntry{
+		ReaderID:     reader.ID,
+		LibID:        user.LibID,
+		Kind:         kind,
+		Amount:       req.Amount,
+		Note:         req.Note,
+		RecordedByID: &user.ID,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error recording fine entry"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit error"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": kind + " recorded", "entry": entry, "balance": balance - req.Amount})
+}
+
+// RecordFinePayment records a payment made by a reader.
+func RecordFinePayment(c *gin.Context) {
+	recordFineAdjustment(c, models.FinePayment)
+}
+
+// WaiveFine records an admin waiving part or all of a reader's balance.
+func WaiveFine(c *gin.Context) {
+	recordFineAdjustment(c, models.FineWaiver)
+}
@@ -3,11 +3,16 @@ package handlers
 
 import (
 	"bytes"
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"regexp"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
@@ -16,7 +21,9 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"lms/backend/config"
+	"lms/backend/marc"
 	"lms/backend/middlewares"
+	"lms/backend/models"
 	//"lms/backend/handlers"
 	//"lms/backend/handlers"
 )
@@ -123,6 +130,7 @@ func TestCreateAdmin_Success(t *testing.T) {
 		Name:          "Admin",
 		Email:         "admin@example.com",
 		ContactNumber: "1234567890",
+		Password:      "s3cret-pass",
 	}
 	body, _ := json.Marshal(reqBody)
 	req, _ := http.NewRequest("POST", "/api/owner/admin/create", bytes.NewReader(body))
@@ -142,7 +150,7 @@ func TestCreateAdmin_Success(t *testing.T) {
 	// Expect a database transaction for creating the new admin.
 	mock.ExpectBegin()
 	// GORM uses a Query with a RETURNING clause for inserts on Postgres.
-	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","name","email","contact_number","role","lib_id") VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING "id"`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","name","email","contact_number","role","lib_id","password_hash") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id"`)).
 		WithArgs(
 			sqlmock.AnyArg(), // created_at
 			sqlmock.AnyArg(), // updated_at
@@ -152,6 +160,7 @@ func TestCreateAdmin_Success(t *testing.T) {
 			reqBody.ContactNumber,
 			"LibraryAdmin",   // Role for the new admin.
 			ownerUser.LibID,
+			sqlmock.AnyArg(), // password_hash
 		).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
@@ -197,10 +206,11 @@ func TestCreateLibrary_Success(t *testing.T) {
 
 	// Prepare a valid request payload.
 	reqPayload := CreateLibraryRequest{
-		LibraryName:  "Test Library",
-		OwnerName:    "Owner Name",
-		OwnerEmail:   "owner@example.com",
-		OwnerContact: "1234567890",
+		LibraryName:   "Test Library",
+		OwnerName:     "Owner Name",
+		OwnerEmail:    "owner@example.com",
+		OwnerContact:  "1234567890",
+		OwnerPassword: "s3cret-pass",
 	}
 	payload, _ := json.Marshal(reqPayload)
 	req, _ := http.NewRequest("POST", "/api/library/create", bytes.NewBuffer(payload))
@@ -224,7 +234,7 @@ func TestCreateLibrary_Success(t *testing.T) {
 
 	// ---- Expectation: Create the owner user ----
 	mock.ExpectBegin()
-	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","name","email","contact_number","role","lib_id") VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING "id"`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","name","email","contact_number","role","lib_id","password_hash") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id"`)).
 		WithArgs(
 			sqlmock.AnyArg(), // created_at
 			sqlmock.AnyArg(), // updated_at
@@ -234,6 +244,7 @@ func TestCreateLibrary_Success(t *testing.T) {
 			reqPayload.OwnerContact,
 			"Owner", // role for the owner
 			1,       // library ID from the inserted library
+			sqlmock.AnyArg(), // password_hash
 		).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
@@ -264,10 +275,11 @@ func TestCreateLibrary_Duplicate(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	reqBody := map[string]string{
-		"libraryName":  "Test Library",
-		"OwnerName":    "Owner",
-		"ownerEmail":   "owner@example.com",
-		"ownerContact": "1234567890",
+		"libraryName":   "Test Library",
+		"OwnerName":     "Owner",
+		"ownerEmail":    "owner@example.com",
+		"ownerContact":  "1234567890",
+		"ownerPassword": "s3cret-pass",
 	}
 	body, _ := json.Marshal(reqBody)
 	req, _ := http.NewRequest("POST", "/api/library/create", bytes.NewReader(body))
@@ -316,6 +328,25 @@ func TestAddBook_InvalidPayload(t *testing.T) {
 	assert.Equal(t, "Missing or invalid required book fields", resp["error"])
 }
 
+// Test that an ISBN with a wrong check digit is rejected with the reason.
+func TestAddBook_InvalidISBN(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/admin/books",
+		bytes.NewBufferString(`{"ISBN": "978-0-13-110362-8", "Title": "Test Book", "Authors": "Author1", "Copies": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Set(string(middlewares.UserContextKey), middlewares.User{ID: 1, LibID: 1})
+
+	AddBook(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Invalid ISBN: check digit does not match, expected 7", resp["error"])
+}
+
 // Test for creating a new book when no book exists with the given ISBN.
 func TestAddBook_New(t *testing.T) {
 	_, mock := setupTestDB(t)
@@ -329,7 +360,7 @@ func TestAddBook_New(t *testing.T) {
 
 	// Prepare a valid request payload.
 	reqPayload := AddBookRequest{
-		ISBN:      "12345",
+		ISBN:      "9780131103627",
 		Title:     "Test Book",
 		Authors:   "Author1, Author2",
 		Publisher: "Test Publisher",
@@ -342,25 +373,41 @@ func TestAddBook_New(t *testing.T) {
 	c.Request = req
 
 	// Expect a SELECT query for the book by ISBN including ORDER BY and LIMIT.
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "books" WHERE isbn = $1 ORDER BY "books"."isbn" LIMIT $2`)).
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "books" WHERE isbn = $1 AND lib_id = $2 ORDER BY "books"."isbn" LIMIT $3`)).
+		WithArgs(reqPayload.ISBN, user.LibID, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+	// No library has catalogued the ISBN either.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "editions" WHERE isbn = $1 ORDER BY "editions"."isbn" LIMIT $2`)).
 		WithArgs(reqPayload.ISBN, 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 
-	// Expect an INSERT query for creating the new book.
+	// Expect INSERT queries for the shared edition and the library's holding.
 	// GORM is using Exec (without RETURNING clause) in this case.
-	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "books" ("isbn","lib_id","title","authors","publisher","version","total_copies","available_copies") VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`)).
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "editions" ("isbn","title","authors","publisher","version","created_at","updated_at") VALUES ($1,$2,$3,$4,$5,$6,$7) ON CONFLICT DO NOTHING`)).
 		WithArgs(
 			reqPayload.ISBN,
-			user.LibID,
 			reqPayload.Title,
 			reqPayload.Authors,
 			reqPayload.Publisher,
 			reqPayload.Version,
+			sqlmock.AnyArg(),
+			sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "books" ("isbn","lib_id","shelf_location","total_copies","available_copies","created_at") VALUES ($1,$2,$3,$4,$5,$6)`)).
+		WithArgs(
+			reqPayload.ISBN,
+			user.LibID,
+			"",
 			reqPayload.Copies,
 			reqPayload.Copies,
+			sqlmock.AnyArg(),
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	// One copy with a generated barcode is created for each requested copy.
+	mock.ExpectQuery(`INSERT INTO "book_copies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3).AddRow(4).AddRow(5))
 	mock.ExpectCommit()
 
 	// Call the handler.
@@ -376,8 +423,9 @@ func TestAddBook_New(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-// Test for existing book in a different library.
-func TestAddBook_Exists_DifferentLibrary(t *testing.T) {
+// Test that an ISBN held by another library can still be added to this one,
+// reusing the edition record that library created.
+func TestAddBook_SameISBNInAnotherLibrary(t *testing.T) {
 	_, mock := setupTestDB(t)
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
@@ -388,36 +436,44 @@ func TestAddBook_Exists_DifferentLibrary(t *testing.T) {
 	c.Set(string(middlewares.UserContextKey), user)
 
 	reqPayload := AddBookRequest{
-		ISBN:      "12345",
+		ISBN:      "9780131103627",
 		Title:     "Test Book",
 		Authors:   "Author1",
 		Publisher: "Test Publisher",
 		Version:   "1st Edition",
-		Copies:    5,
+		Copies:    2,
 	}
 	payload, _ := json.Marshal(reqPayload)
 	req, _ := http.NewRequest("POST", "/api/admin/books", bytes.NewBuffer(payload))
 	req.Header.Set("Content-Type", "application/json")
 	c.Request = req
 
-	// Simulate an existing book with the same ISBN but from a different library.
-	rows := sqlmock.NewRows([]string{
-		"isbn", "lib_id", "title", "authors", "publisher", "version", "total_copies", "available_copies",
-	}).AddRow(reqPayload.ISBN, 2, reqPayload.Title, reqPayload.Authors, reqPayload.Publisher, reqPayload.Version, 10, 10)
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "books" WHERE isbn = $1 ORDER BY "books"."isbn" LIMIT $2`)).
+	// Library 2 holds the ISBN, but the lookup is keyed on this library only.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "books" WHERE isbn = $1 AND lib_id = $2 ORDER BY "books"."isbn" LIMIT $3`)).
+		WithArgs(reqPayload.ISBN, user.LibID, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "editions" WHERE isbn = $1 ORDER BY "editions"."isbn" LIMIT $2`)).
 		WithArgs(reqPayload.ISBN, 1).
-		WillReturnRows(rows)
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title", "authors"}).AddRow(reqPayload.ISBN, "Original Title", "Author1"))
+	// The shared edition is left as it is; only the holding is created.
+	mock.ExpectExec(`INSERT INTO "books"`).
+		WithArgs(reqPayload.ISBN, user.LibID, "", 2, 2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO "book_copies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectCommit()
 
 	// Call the handler.
 	AddBook(c)
 
-	// Assert that a 400 Bad Request is returned.
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	// Assert that the book is created for this library.
+	assert.Equal(t, http.StatusCreated, w.Code)
 
 	var resp map[string]string
 	err := json.Unmarshal(w.Body.Bytes(), &resp)
 	assert.NoError(t, err)
-	assert.Equal(t, "Book with this ISBN already exists in another library", resp["error"])
+	assert.Equal(t, "Book added successfully", resp["message"])
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -433,7 +489,7 @@ func TestAddBook_Exists_SameLibrary(t *testing.T) {
 	c.Set(string(middlewares.UserContextKey), user)
 
 	reqPayload := AddBookRequest{
-		ISBN:      "12345",
+		ISBN:      "9780131103627",
 		Title:     "Test Book",
 		Authors:   "Author1",
 		Publisher: "Test Publisher",
@@ -447,23 +503,26 @@ func TestAddBook_Exists_SameLibrary(t *testing.T) {
 
 	// Expect a SELECT query that looks for a book with this ISBN.
 	// GORM generates a query with ORDER BY and LIMIT two parameters.
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "books" WHERE isbn = $1 ORDER BY "books"."isbn" LIMIT $2`)).
-		WithArgs(reqPayload.ISBN, 1).
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "books" WHERE isbn = $1 AND lib_id = $2 ORDER BY "books"."isbn" LIMIT $3`)).
+		WithArgs(reqPayload.ISBN, user.LibID, 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
 				AddRow(reqPayload.ISBN, user.LibID, 10, 10),
 		)
 
-	// Since the book exists in the same library, the handler updates the copies.
-	// GORM's Save method will update all fields. In our case, since title, authors, publisher,
-	// and version were not returned by the SELECT, their values are zero (empty string).
-	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(
-		`UPDATE "books" SET "title"=$1,"authors"=$2,"publisher"=$3,"version"=$4,"total_copies"=$5,"available_copies"=$6 WHERE "isbn" = $7 AND "lib_id" = $8`,
-	)).
-		WithArgs("", "", "", "", 15, 15, reqPayload.ISBN, user.LibID).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-	
+	// Since the book exists in the same library, the handler adds the new copies
+	// and recomputes the book's counts from them.
+	mock.ExpectQuery(`INSERT INTO "book_copies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3).AddRow(4).AddRow(5))
+
+	// The new copies are offered to the hold queue first; nobody is waiting here.
+	mock.ExpectQuery(`SELECT \* FROM "holds" WHERE \(isbn = \$1 AND lib_id = \$2 AND status = \$3\)`).
+		WithArgs(reqPayload.ISBN, user.LibID, "Waiting", reqPayload.Copies).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "lib_id", "reader_id", "status"}))
+	mock.ExpectExec(`UPDATE books SET`).
+		WithArgs("Withdrawn", "Available", reqPayload.ISBN, user.LibID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
 	// Call the handler.
@@ -493,7 +552,7 @@ func TestAddBook_DuplicateISBN(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	reqBody := map[string]interface{}{
-		"isbn":      "12345",
+		"isbn":      "9780131103627",
 		"title":     "Test Book",
 		"authors":   "John Doe",
 		"publisher": "Test Publisher",
@@ -541,7 +600,7 @@ func TestRemoveBook_NotFound(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	isbn := "12345"
+	isbn := "9780131103627"
 	reqBody := map[string]int{"CopiesToRemove": 1}
 	body, _ := json.Marshal(reqBody)
 	req, _ := http.NewRequest("DELETE", "/api/admin/books/"+isbn, bytes.NewReader(body))
@@ -579,7 +638,7 @@ func TestUpdateBook_NoFields(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	isbn := "12345"
+	isbn := "9780131103627"
 	reqBody := map[string]interface{}{} // empty update data
 	body, _ := json.Marshal(reqBody)
 	req, _ := http.NewRequest("PUT", "/api/admin/books/"+isbn, bytes.NewReader(body))
@@ -595,6 +654,87 @@ func TestUpdateBook_NoFields(t *testing.T) {
 	}
 }
 
+// Test that copy counts and keys cannot be changed through UpdateBook.
+func TestUpdateBook_RejectsNonMetadataFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, body := range []string{`{"available_copies": 50}`, `{"Title": "New", "lib_id": 2}`, `{"ISBN": "999"}`} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		req, _ := http.NewRequest("PUT", "/api/admin/books/9780131103627", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		c.Request = req
+		c.Params = gin.Params{{Key: "isbn", Value: "9780131103627"}}
+		c.Set(string(middlewares.UserContextKey), middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1})
+
+		UpdateBook(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, "Only Title, Authors, Publisher, Version and ShelfLocation can be updated", resp["error"], body)
+	}
+}
+
+// Test that updating a book outside the admin's library returns 404. The
+// ISBN-10 in the path is looked up in its ISBN-13 form.
+func TestUpdateBook_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("PUT", "/api/admin/books/0-13-110362-8", bytes.NewBufferString(`{"Title": "Renamed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Params = gin.Params{{Key: "isbn", Value: "0-13-110362-8"}}
+	user := middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE isbn = \$1 AND lib_id = \$2`).
+		WithArgs("9780131103627", user.LibID, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	UpdateBook(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that metadata corrections go to the shared edition and the shelf
+// location to the library's own holding.
+func TestUpdateBook_SplitsEditionAndHolding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("PUT", "/api/admin/books/9780131103627", bytes.NewBufferString(`{"Title": " Renamed ", "ShelfLocation": "B-2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Params = gin.Params{{Key: "isbn", Value: "9780131103627"}}
+	user := middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE isbn = \$1 AND lib_id = \$2`).
+		WithArgs("9780131103627", user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "shelf_location"}).AddRow("9780131103627", user.LibID, "A-1"))
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE "editions"."isbn" = \$1`).
+		WithArgs("9780131103627").
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title", "authors"}).AddRow("9780131103627", "Old", "Author1"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "editions" SET "title"=\$1,"updated_at"=\$2 WHERE isbn = \$3`).
+		WithArgs("Renamed", sqlmock.AnyArg(), "9780131103627").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "books" SET "shelf_location"=\$1 WHERE isbn = \$2 AND lib_id = \$3`).
+		WithArgs("B-2", "9780131103627", user.LibID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	UpdateBook(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Title":"Renamed"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // ----------------------
 // ListIssueRequests Tests
 // ----------------------
@@ -649,16 +789,16 @@ func TestApproveIssueRequest_BookUnavailable(t *testing.T) {
 
 	// Return a request event with nil ApprovalDate.
 	rowsReq := sqlmock.NewRows([]string{"id", "book_id", "reader_id", "approval_date"}).
-		AddRow(1, "12345", 2, nil)
+		AddRow(1, "9780131103627", 2, nil)
 	mock.ExpectQuery(`SELECT \* FROM request_events WHERE id = \?`).
 		WithArgs(reqIDStr).
 		WillReturnRows(rowsReq)
 
 	// Return a book with available copies 0.
 	rowsBook := sqlmock.NewRows([]string{"isbn", "lib_id", "available_copies"}).
-		AddRow("12345", user.LibID, 0)
+		AddRow("9780131103627", user.LibID, 0)
 	mock.ExpectQuery(`SELECT \* FROM books WHERE isbn = \? AND lib_id = \?`).
-		WithArgs("12345", user.LibID).
+		WithArgs("9780131103627", user.LibID).
 		WillReturnRows(rowsBook)
 
 	ApproveIssueRequest(c)
@@ -688,6 +828,33 @@ func TestRejectIssueRequest_InvalidReqID(t *testing.T) {
 	}
 }
 
+// Test that a request that was already approved cannot be rejected.
+func TestRejectIssueRequest_AlreadyProcessed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/admin/requests/1/reject", bytes.NewBufferString(`{"reason": "Reserved for a class"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "reqid", Value: "1"})
+
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "request_events" WHERE request_events.id = \$1 AND request_events.lib_id = \$2`).
+		WithArgs(1, user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "reader_id", "status"}).AddRow(1, "9780131103627", 2, "Approved"))
+
+	RejectIssueRequest(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Request already processed", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // ----------------------
 // SignIn Tests
 // ----------------------
@@ -782,6 +949,7 @@ func TestCreateReader_InvalidLibrary(t *testing.T) {
 		Email:         "john@example.com",
 		ContactNumber: "1234567890",
 		LibID:         999, // Assume this library ID does not exist.
+		Password:      "s3cret-pass",
 	}
 	payload, _ := json.Marshal(reqPayload)
 	req, _ := http.NewRequest("POST", "/api/reader/create", bytes.NewBuffer(payload))
@@ -822,6 +990,7 @@ func TestCreateReader_Success(t *testing.T) {
 		Email:         "alice@example.com",
 		ContactNumber: "9876543210",
 		LibID:         1,
+		Password:      "s3cret-pass",
 	}
 	payload, _ := json.Marshal(reqPayload)
 	req, _ := http.NewRequest("POST", "/api/reader/create", bytes.NewBuffer(payload))
@@ -836,7 +1005,7 @@ func TestCreateReader_Success(t *testing.T) {
 
 	// Expect an INSERT query to create the new reader.
 	mock.ExpectBegin()
-	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","name","email","contact_number","role","lib_id") VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING "id"`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","name","email","contact_number","role","lib_id","password_hash") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id"`)).
 		WithArgs(
 			sqlmock.AnyArg(), // created_at
 			sqlmock.AnyArg(), // updated_at
@@ -846,6 +1015,7 @@ func TestCreateReader_Success(t *testing.T) {
 			reqPayload.ContactNumber,
 			"Reader",
 			reqPayload.LibID,
+			sqlmock.AnyArg(), // password_hash
 		).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
@@ -872,3 +1042,1380 @@ func TestCreateReader_Success(t *testing.T) {
 }
 
 
+
+// ----------------------
+// ReturnBook Tests
+// ----------------------
+
+// Test ReturnBook with an invalid issue ID.
+func TestReturnBook_InvalidID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/admin/issues/abc/return", nil)
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: "abc"})
+
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	ReturnBook(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Test that a book which was already returned cannot be returned again.
+func TestReturnBook_AlreadyReturned(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/admin/issues/7/return", nil)
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: "7"})
+
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "issue_registries" WHERE issue_registries.id = \$1 AND issue_registries.lib_id = \$2`).
+		WithArgs(7, user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "reader_id", "issue_status"}).
+			AddRow(7, "9780131103627", 2, "Returned"))
+	mock.ExpectRollback()
+
+	ReturnBook(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Book already returned", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test SignIn with a wrong password.
+func TestSignIn_WrongPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal(SignInRequest{Email: "user@example.com", Password: "wrong-password"})
+	req, _ := http.NewRequest("POST", "/api/signin", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	hash, _ := hashPassword("right-password")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("user@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "lib_id", "password_hash"}).
+			AddRow(1, "user@example.com", "Reader", 1, hash))
+
+	SignIn(c)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Invalid email or password", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test successful SignIn returns a verifiable access token and a refresh token.
+func TestSignIn_Success(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal(SignInRequest{Email: "user@example.com", Password: "right-password"})
+	req, _ := http.NewRequest("POST", "/api/signin", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	hash, _ := hashPassword("right-password")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("user@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "lib_id", "password_hash"}).
+			AddRow(1, "user@example.com", "Reader", 3, hash))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "refresh_tokens"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	SignIn(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp["refreshToken"])
+	claims, err := middlewares.ParseAccessToken(resp["accessToken"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), claims.UserID)
+	assert.Equal(t, "Reader", claims.Role)
+	assert.Equal(t, uint(3), claims.LibID)
+	assert.NotContains(t, w.Body.String(), "password")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that a refresh token revoked by a concurrent request cannot be used again.
+func TestRefreshToken_ConcurrentReplay(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal(RefreshTokenRequest{RefreshToken: "old-token"})
+	req, _ := http.NewRequest("POST", "/api/refresh", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "refresh_tokens" WHERE (token_hash = $1 AND revoked_at IS NULL AND expires_at > $2)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(7, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "lib_id"}).
+			AddRow(1, "user@example.com", "Reader", 3))
+	mock.ExpectBegin()
+	// The other request revoked the token between the lookup and the update.
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1,"updated_at"=$2 WHERE (id = $3 AND revoked_at IS NULL)`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	RefreshToken(c)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "refreshToken")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------
+// RenewIssue Tests
+// ----------------------
+
+// Test that a loan cannot be renewed past the library's renewal limit.
+func TestRenewIssue_LimitReached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/reader/issues/5/renew", nil)
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: "5"})
+
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "issue_registries" WHERE \(id = \$1 AND reader_id = \$2\)`).
+		WithArgs(5, user.ID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "reader_id", "issue_status", "renewal_count"}).
+			AddRow(5, "9780131103627", user.ID, "Issued", 2))
+	mock.ExpectQuery(`SELECT \* FROM "circulation_policies" WHERE lib_id = \$1`).
+		WithArgs(user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lib_id", "loan_period_days", "max_renewals"}).
+			AddRow(1, user.LibID, 14, 2))
+	mock.ExpectRollback()
+
+	RenewIssue(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Renewal limit reached for this book", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that only the owner can change the circulation policy.
+func TestUpdateCirculationPolicy_Forbidden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("PUT", "/api/owner/policy", bytes.NewBufferString(`{"maxRenewals": 5}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	UpdateCirculationPolicy(c)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// ----------------------
+// Hold Tests
+// ----------------------
+
+// Test that saving the policy upserts on lib_id and writes only the requested
+// fields of an existing policy, zero values included.
+func TestUpdateCirculationPolicy_Upsert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("PUT", "/api/owner/policy", bytes.NewBufferString(`{"maxRenewals": 0}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	user := middlewares.User{ID: 1, Name: "Owner", Email: "owner@example.com", Role: "Owner", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "circulation_policies" .* ON CONFLICT \("lib_id"\) DO UPDATE SET "max_renewals"=\$\d+,"updated_at"=\$\d+`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "circulation_policies" WHERE lib_id = \$1`).
+		WithArgs(user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lib_id", "max_loans", "max_renewals"}).AddRow(1, user.LibID, 3, 0))
+
+	UpdateCirculationPolicy(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Policy models.CirculationPolicy `json:"policy"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 3, resp.Policy.MaxLoans)
+	assert.Equal(t, 0, resp.Policy.MaxRenewals)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that a hold cannot be placed while copies are still available.
+func TestPlaceHold_BookAvailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/reader/holds", bytes.NewBufferString(`{"ISBN": "9780131103627"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE isbn = \$1 AND lib_id = \$2`).
+		WithArgs("9780131103627", user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
+			AddRow("9780131103627", user.LibID, 3, 1))
+
+	PlaceHold(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that a hold placed concurrently with the same reader's other request
+// is refused by the unique index on active holds.
+func TestPlaceHold_ConcurrentDuplicate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/reader/holds", bytes.NewBufferString(`{"ISBN": "9780131103627"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE isbn = \$1 AND lib_id = \$2`).
+		WithArgs("9780131103627", user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
+			AddRow("9780131103627", user.LibID, 1, 0))
+	mock.ExpectQuery(`SELECT \* FROM "issue_registries"`).
+		WillReturnRows(sqlmock.NewRows([]string{"issue_id"}))
+	mock.ExpectQuery(`SELECT \* FROM "holds"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "holds" .* ON CONFLICT DO NOTHING RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	PlaceHold(c)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "You already have a hold on this book", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that ListHolds computes every queue position in a single query.
+func TestListHolds_Positions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reader/holds", nil)
+
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "holds" WHERE \(reader_id = \$1 AND lib_id = \$2 AND status IN \(\$3,\$4\)\)`).
+		WithArgs(user.ID, user.LibID, models.HoldWaiting, models.HoldReady).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "lib_id", "reader_id", "status"}).
+			AddRow(4, "9780131103627", user.LibID, user.ID, models.HoldWaiting).
+			AddRow(6, "9780201633610", user.LibID, user.ID, models.HoldReady).
+			AddRow(9, "9780262033848", user.LibID, user.ID, models.HoldWaiting))
+	mock.ExpectQuery(`SELECT id, position FROM \(SELECT id, reader_id, ROW_NUMBER\(\) OVER \(PARTITION BY lib_id, isbn ORDER BY placed_at, id\) AS position FROM "holds" ` +
+		`WHERE \(lib_id = \$1 AND isbn IN \(\$2,\$3\) AND status = \$4\) AND "holds"."deleted_at" IS NULL\) AS queues WHERE reader_id = \$5`).
+		WithArgs(user.LibID, "9780131103627", "9780262033848", models.HoldWaiting, user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "position"}).AddRow(4, 3).AddRow(9, 1))
+
+	ListHolds(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Holds []map[string]interface{} `json:"holds"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Holds, 3)
+	assert.Equal(t, float64(3), resp.Holds[0]["position"])
+	assert.NotContains(t, resp.Holds[1], "position")
+	assert.Equal(t, float64(1), resp.Holds[2]["position"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that a reader cannot cancel a hold that is not theirs.
+func TestCancelHold_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/reader/holds/9/cancel", nil)
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: "9"})
+
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "holds" WHERE \(id = \$1 AND reader_id = \$2\)`).
+		WithArgs(9, user.ID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	CancelHold(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------
+// Circulation Policy Tests
+// ----------------------
+
+// Test that RaiseIssueRequest enforces the library's maximum number of loans.
+func TestRaiseIssueRequest_MaxLoansReached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/reader/request", bytes.NewBufferString(`{"ISBN": "9780131103627"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE isbn = \$1 AND lib_id = \$2`).
+		WithArgs("9780131103627", user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
+			AddRow("9780131103627", user.LibID, 3, 2))
+	mock.ExpectQuery(`SELECT \* FROM "holds"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "circulation_policies" WHERE lib_id = \$1`).
+		WithArgs(user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lib_id", "loan_period_days", "max_loans", "max_copies_per_title", "max_pending_requests"}).
+			AddRow(1, user.LibID, 14, 1, 1, 5))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "issue_registries" WHERE \(reader_id = \$1 AND issue_status = \$2\)`).
+		WithArgs(user.ID, "Issued").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	RaiseIssueRequest(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Maximum of 1 active loans reached", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------
+// Fines Tests
+// ----------------------
+
+// Test that overdue fines only count the days late beyond the grace period.
+func TestOverdueFine(t *testing.T) {
+	policy := models.CirculationPolicy{FinePerDay: 10, GraceDays: 2}
+	due := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, int64(0), overdueFine(policy, due, due.AddDate(0, 0, -1)))
+	assert.Equal(t, int64(0), overdueFine(policy, due, due.AddDate(0, 0, 2)))
+	assert.Equal(t, int64(10), overdueFine(policy, due, due.AddDate(0, 0, 3)))
+	assert.Equal(t, int64(80), overdueFine(policy, due, due.AddDate(0, 0, 10)))
+}
+
+// Test that a payment larger than the outstanding balance is refused.
+func TestRecordFinePayment_ExceedsBalance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/admin/readers/2/fines/payments", bytes.NewBufferString(`{"amount": 300}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: "2"})
+
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(id = \$1 AND lib_id = \$2 AND role = \$3\)`).
+		WithArgs(2, user.LibID, "Reader", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "lib_id"}).AddRow(2, "Reader", user.LibID))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id" FROM "users" WHERE id = \$1 .* FOR UPDATE`).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery(`SELECT COALESCE\(SUM\(CASE WHEN kind = \$1 THEN amount ELSE -amount END\), 0\) FROM "fine_entries"`).
+		WithArgs("Charge", 2, user.LibID).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(120))
+	mock.ExpectRollback()
+
+	RecordFinePayment(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Amount exceeds the outstanding balance", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------
+// Book Copy Tests
+// ----------------------
+
+// Test that a copy that is out on loan cannot be withdrawn by barcode.
+func TestRemoveBook_CopyIssued(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	isbn := "9780131103627"
+	req, _ := http.NewRequest("DELETE", "/api/admin/books/"+isbn, bytes.NewBufferString(`{"Barcodes": ["B-1"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "isbn", Value: isbn})
+
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE isbn = \$1 AND lib_id = \$2`).
+		WithArgs(isbn, user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).AddRow(isbn, user.LibID, 1, 0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "book_copies" WHERE \(isbn = \$1 AND lib_id = \$2 AND barcode IN \(\$3\) AND status <> \$4\)`).
+		WithArgs(isbn, user.LibID, "B-1", "Withdrawn").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "lib_id", "barcode", "status"}).AddRow(1, isbn, user.LibID, "B-1", "Issued"))
+	mock.ExpectRollback()
+
+	RemoveBook(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Cannot remove copies that are issued or on hold", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that naming a barcode twice is rejected before any copy is looked up.
+func TestRemoveBook_DuplicateBarcode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	isbn := "9780131103627"
+	req, _ := http.NewRequest("DELETE", "/api/admin/books/"+isbn, bytes.NewBufferString(`{"Barcodes": ["B-1", "B-2", "B-1"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "isbn", Value: isbn})
+
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	RemoveBook(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Duplicate barcode B-1", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that updating a copy writes only the requested columns, never its status.
+func TestUpdateBookCopy_OnlyRequestedColumns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("PATCH", "/api/admin/copies/B-1", bytes.NewBufferString(`{"Condition": "Damaged"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "barcode", Value: "B-1"})
+
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "book_copies" WHERE \(barcode = \$1 AND lib_id = \$2\)`).
+		WithArgs("B-1", user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "lib_id", "barcode", "condition", "status"}).
+			AddRow(1, "9780131103627", user.LibID, "B-1", "Good", "Available"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "book_copies" SET "condition"=\$1,"updated_at"=\$2 WHERE`).
+		WithArgs("Damaged", sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	UpdateBookCopy(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------
+// CancelRequest Tests
+// ----------------------
+
+// Test that a reader cannot cancel a request raised by someone else.
+func TestCancelRequest_OtherReader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("POST", "/api/reader/requests/7/cancel", nil)
+	c.Request = req
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: "7"})
+
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT \* FROM "request_events" WHERE \(id = \$1 AND reader_id = \$2\)`).
+		WithArgs(7, user.ID, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	CancelRequest(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------
+// Reader Loans Tests
+// ----------------------
+
+// Test that active loans are paginated and flag the overdue ones.
+func TestListMyLoans_FlagsOverdue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("GET", "/api/reader/loans?page=2&pageSize=2", nil)
+	c.Request = req
+
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "issue_registries" WHERE \(reader_id = \$1 AND issue_status = \$2\)`).
+		WithArgs(user.ID, "Issued").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectQuery(`SELECT \* FROM "issue_registries" WHERE \(reader_id = \$1 AND issue_status = \$2\) AND "issue_registries"."deleted_at" IS NULL ORDER BY expected_return_date ASC, id ASC LIMIT \$3 OFFSET \$4`).
+		WithArgs(user.ID, "Issued", 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "reader_id", "issue_status", "expected_return_date"}).
+			AddRow(3, "111", user.ID, "Issued", time.Now().AddDate(0, 0, -3)).
+			AddRow(4, "222", user.ID, "Issued", time.Now().AddDate(0, 0, 5)))
+
+	ListMyLoans(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Loans []struct {
+			ISBN        string `json:"isbn"`
+			Overdue     bool   `json:"overdue"`
+			DaysOverdue int    `json:"daysOverdue"`
+		} `json:"loans"`
+		Total int64 `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, int64(4), resp.Total)
+	assert.Len(t, resp.Loans, 2)
+	assert.True(t, resp.Loans[0].Overdue)
+	assert.Equal(t, 3, resp.Loans[0].DaysOverdue)
+	assert.False(t, resp.Loans[1].Overdue)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------
+// Idempotency Tests
+// ----------------------
+
+// Test that a retried approval with a used Idempotency-Key gets the stored
+// response without running the handler again.
+func TestIdempotencyMiddleware_ReplaysStoredResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+
+	router := gin.New()
+	router.POST("/api/admin/requests/:reqid/approve", func(c *gin.Context) {
+		c.Set(string(middlewares.UserContextKey), user)
+	}, middlewares.IdempotencyMiddleware, func(c *gin.Context) {
+		t.Fatal("handler must not run for a replayed request")
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "idempotency_keys" WHERE user_id = \$1 AND key = \$2 AND \(created_at < \$3 OR \(status_code = 0 AND created_at < \$4\)\)`).
+		WithArgs(user.ID, "retry-1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "idempotency_keys" .* ON CONFLICT DO NOTHING RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "idempotency_keys" WHERE user_id = \$1 AND key = \$2`).
+		WithArgs(user.ID, "retry-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "key", "route", "request_hash", "status_code", "response_body"}).
+			AddRow(5, user.ID, "retry-1", "POST /api/admin/requests/3/approve", middlewares.HashIdempotentRequest("", nil),
+				200, []byte(`{"message":"Issue request approved and book issued"}`)))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/admin/requests/3/approve", nil)
+	req.Header.Set(middlewares.IdempotencyKeyHeader, "retry-1")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, `{"message":"Issue request approved and book issued"}`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that reusing an Idempotency-Key with a different body is refused
+// rather than answered with the first request's response.
+func TestIdempotencyMiddleware_DifferentBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	user := middlewares.User{ID: 2, Name: "Reader", Email: "reader@example.com", Role: "Reader", LibID: 1}
+
+	router := gin.New()
+	router.POST("/api/reader/request", func(c *gin.Context) {
+		c.Set(string(middlewares.UserContextKey), user)
+	}, middlewares.IdempotencyMiddleware, func(c *gin.Context) {
+		t.Fatal("handler must not run for a reused key")
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "idempotency_keys"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "idempotency_keys" .* ON CONFLICT DO NOTHING RETURNING "id"`).
+		WithArgs(user.ID, "retry-1", "POST /api/reader/request",
+			middlewares.HashIdempotentRequest("", []byte(`{"ISBN": "9780201633610"}`)), 0, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "idempotency_keys" WHERE user_id = \$1 AND key = \$2`).
+		WithArgs(user.ID, "retry-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "key", "route", "request_hash", "status_code", "response_body"}).
+			AddRow(5, user.ID, "retry-1", "POST /api/reader/request", middlewares.HashIdempotentRequest("", []byte(`{"ISBN": "9780131103627"}`)),
+				201, []byte(`{"message":"Issue request raised successfully"}`)))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/reader/request", bytes.NewBufferString(`{"ISBN": "9780201633610"}`))
+	req.Header.Set(middlewares.IdempotencyKeyHeader, "retry-1")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that a handler panic releases the claimed Idempotency-Key so a retry
+// is not refused as still in progress.
+func TestIdempotencyMiddleware_PanicReleasesKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	user := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.POST("/api/admin/requests/:reqid/approve", func(c *gin.Context) {
+		c.Set(string(middlewares.UserContextKey), user)
+	}, middlewares.IdempotencyMiddleware, func(c *gin.Context) {
+		panic("approval failed")
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "idempotency_keys" WHERE user_id = \$1 AND key = \$2`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "idempotency_keys" .* ON CONFLICT DO NOTHING RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "idempotency_keys" WHERE "idempotency_keys"."id" = \$1`).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/admin/requests/3/approve", nil)
+	req.Header.Set(middlewares.IdempotencyKeyHeader, "retry-1")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ----------------------
+// Tenant Isolation Tests
+// ----------------------
+
+// Test that an admin of library 1 cannot read, approve, reject or return
+// records that belong to library 2. Every lookup is scoped to the admin's
+// library, so the records look missing.
+func TestAdminCannotReachOtherLibrary(t *testing.T) {
+	admin := middlewares.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: "LibraryAdmin", LibID: 1}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		params  gin.Params
+		handler gin.HandlerFunc
+		expect  func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:    "approve",
+			method:  "POST",
+			path:    "/api/admin/requests/9/approve",
+			params:  gin.Params{{Key: "reqid", Value: "9"}},
+			handler: ApproveIssueRequest,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "request_events" WHERE request_events.id = \$1 AND request_events.lib_id = \$2 .* FOR UPDATE`).
+					WithArgs(9, admin.LibID, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:    "reject",
+			method:  "POST",
+			path:    "/api/admin/requests/9/reject",
+			params:  gin.Params{{Key: "reqid", Value: "9"}},
+			handler: RejectIssueRequest,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "request_events" WHERE request_events.id = \$1 AND request_events.lib_id = \$2`).
+					WithArgs(9, admin.LibID, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			name:    "return",
+			method:  "POST",
+			path:    "/api/admin/issues/4/return",
+			params:  gin.Params{{Key: "id", Value: "4"}},
+			handler: ReturnBook,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "issue_registries" WHERE issue_registries.id = \$1 AND issue_registries.lib_id = \$2`).
+					WithArgs(4, admin.LibID, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:    "reader fines",
+			method:  "GET",
+			path:    "/api/admin/readers/5/fines",
+			params:  gin.Params{{Key: "id", Value: "5"}},
+			handler: GetReaderFines,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(id = \$1 AND lib_id = \$2 AND role = \$3\)`).
+					WithArgs(5, admin.LibID, "Reader", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			_, mock := setupTestDB(t)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			c.Request = req
+			c.Params = tc.params
+			c.Set(string(middlewares.UserContextKey), admin)
+			tc.expect(mock)
+
+			tc.handler(c)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("list requests", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		_, mock := setupTestDB(t)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		req, _ := http.NewRequest("GET", "/api/admin/requests?status=all", nil)
+		c.Request = req
+		c.Set(string(middlewares.UserContextKey), admin)
+
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "request_events" WHERE request_events.lib_id = \$1`).
+			WithArgs(admin.LibID).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery(`SELECT \* FROM "request_events" WHERE request_events.lib_id = \$1 .* ORDER BY request_events.request_date ASC, request_events.id ASC LIMIT \$2`).
+			WithArgs(admin.LibID, defaultPageSize).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		ListIssueRequests(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"requests": [], "page": 1, "pageSize": 20, "total": 0, "next": null}`, w.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// Test that a dry-run import reports every row's outcome and changes nothing.
+func TestImportBooks_DryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	csvBody := "ISBN,Title,Authors,Publisher,Version,Copies\n" +
+		"978-0-13-110362-8,Bad Check Digit,Someone,,,1\n" +
+		"0131103628,The C Programming Language,Kernighan and Ritchie,Prentice Hall,2nd,3\n" +
+		"9780804429573,Different Title,Author1,,,1\n"
+	req, _ := http.NewRequest("POST", "/api/admin/books/import?dryRun=true", bytes.NewBufferString(csvBody))
+	req.Header.Set("Content-Type", "text/csv")
+	c.Request = req
+	user := middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectBegin()
+	// Row 3 is a new ISBN: its edition, holding and copies are created.
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE isbn = \$1`).
+		WithArgs("9780131103627", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE isbn = \$1 AND lib_id = \$2`).
+		WithArgs("9780131103627", user.LibID, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE isbn = \$1`).
+		WithArgs("9780131103627", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+	mock.ExpectExec(`INSERT INTO "editions"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO "books"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO "book_copies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	// Row 4 disagrees with the catalogued edition.
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE isbn = \$1`).
+		WithArgs("9780804429573", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title", "authors"}).AddRow("9780804429573", "Catalogued Title", "Author1"))
+	mock.ExpectRollback()
+
+	ImportBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		DryRun  bool              `json:"dryRun"`
+		Summary map[string]int    `json:"summary"`
+		Rows    []ImportRowResult `json:"rows"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.DryRun)
+	assert.Equal(t, map[string]int{"created": 1, "incremented": 0, "invalid": 1, "conflict": 1}, resp.Summary)
+	assert.Equal(t, []ImportRowResult{
+		{Row: 2, ISBN: "978-0-13-110362-8", Outcome: "invalid", Error: "Invalid ISBN: check digit does not match, expected 7"},
+		{Row: 3, ISBN: "9780131103627", Outcome: "created"},
+		{Row: 4, ISBN: "9780804429573", Outcome: "conflict", Error: `Title "Different Title" differs from the catalogued "Catalogued Title"`},
+	}, resp.Rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that a barcode repeated within a MARC record, or already in use, is
+// reported on its row instead of failing the import.
+func TestImportBooks_DuplicateBarcodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var body bytes.Buffer
+	xw := marc.NewXMLWriter(&body)
+	for _, book := range []marc.Book{
+		{ISBN: "9780131103627", Title: "The C Programming Language", Items: []marc.Item{{Barcode: "B-1"}, {Barcode: "B-1"}}},
+		{ISBN: "9780201633610", Title: "Design Patterns", Items: []marc.Item{{Barcode: "B-2"}, {Barcode: "B-7"}}},
+	} {
+		assert.NoError(t, xw.Write(marc.RecordFromBook(book)))
+	}
+	assert.NoError(t, xw.Close())
+	req, _ := http.NewRequest("POST", "/api/admin/books/import?dryRun=true&format=marcxml", &body)
+	c.Request = req
+	user := middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE isbn = \$1`).
+		WithArgs("9780201633610", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+	mock.ExpectQuery(`SELECT \* FROM "book_copies" WHERE barcode IN \(\$1,\$2\) ORDER BY`).
+		WithArgs("B-2", "B-7", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "barcode"}).AddRow(7, "B-7"))
+	mock.ExpectRollback()
+
+	ImportBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Rows []ImportRowResult `json:"rows"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []ImportRowResult{
+		{Row: 1, ISBN: "9780131103627", Outcome: "invalid", Error: "Barcode B-1 is repeated"},
+		{Row: 2, ISBN: "9780201633610", Outcome: "conflict", Error: "Barcode B-7 is already in use"},
+	}, resp.Rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that the MARCXML export describes each book with its copies in stock.
+func TestExportBooks_MARCXML(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/admin/books/export?format=marcxml", nil)
+	user := middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT .* FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$1 AND books.isbn > \$2 ORDER BY books.isbn ASC LIMIT \$3`).
+		WithArgs(user.LibID, "", exportBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "shelf_location"}).AddRow("9780131103627", user.LibID, "QA76"))
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE "editions"."isbn" = \$1`).
+		WithArgs("9780131103627").
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title", "authors", "publisher", "version"}).
+			AddRow("9780131103627", "The C Programming Language", "Brian W. Kernighan, Dennis M. Ritchie", "Prentice Hall", "2nd"))
+	mock.ExpectQuery(`SELECT \* FROM "book_copies" WHERE \(lib_id = \$1 AND isbn IN \(\$2\) AND status <> \$3\)`).
+		WithArgs(user.LibID, "9780131103627", models.CopyWithdrawn).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "lib_id", "barcode", "shelf_location"}).
+			AddRow(1, "9780131103627", user.LibID, "B-1", "").
+			AddRow(2, "9780131103627", user.LibID, "B-2", "Reserve"))
+
+	ExportBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/marcxml+xml", w.Header().Get("Content-Type"))
+	rec, err := marc.NewXMLReader(w.Body).Read()
+	assert.NoError(t, err)
+	assert.Equal(t, marc.Book{
+		ISBN:      "9780131103627",
+		Title:     "The C Programming Language",
+		Authors:   "Brian W. Kernighan, Dennis M. Ritchie",
+		Publisher: "Prentice Hall",
+		Version:   "2nd",
+		Items:     []marc.Item{{Barcode: "B-1", ShelfLocation: "QA76"}, {Barcode: "B-2", ShelfLocation: "Reserve"}},
+	}, marc.BookFromRecord(rec))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that the CSV export writes the selected columns of the filtered books.
+func TestExportBooks_CSVColumns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/admin/books/export?format=csv&columns=isbn,title,on_loan,availability&author=kernighan", nil)
+	user := middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT .* FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE \(books.lib_id = \$1 AND books.isbn > \$2\) AND editions.authors ILIKE \$3 ORDER BY books.isbn ASC LIMIT \$4`).
+		WithArgs(user.LibID, "", "%kernighan%", exportBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
+			AddRow("9780131103627", user.LibID, 2, 0))
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE "editions"."isbn" = \$1`).
+		WithArgs("9780131103627").
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title"}).AddRow("9780131103627", "The C Programming Language"))
+	mock.ExpectQuery(`SELECT \* FROM "book_copies" WHERE \(lib_id = \$1 AND isbn IN \(\$2\) AND status <> \$3\)`).
+		WithArgs(user.LibID, "9780131103627", models.CopyWithdrawn).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "lib_id", "barcode", "status"}).
+			AddRow(1, "9780131103627", user.LibID, "B-1", models.CopyIssued).
+			AddRow(2, "9780131103627", user.LibID, "B-2", models.CopyOnHold))
+
+	ExportBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "isbn,title,on_loan,availability\n9780131103627,The C Programming Language,1,Not available\n", w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that an XLSX export failing part way answers 500 and removes the
+// workbook's temporary files.
+func TestExportBooks_XLSXErrorRemovesTempFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/admin/books/export?format=xlsx&columns=isbn,title,authors", nil)
+	user := middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	// A full first batch large enough for excelize to spill the sheet to disk.
+	books := sqlmock.NewRows([]string{"isbn", "lib_id"})
+	editions := sqlmock.NewRows([]string{"isbn", "title", "authors"})
+	long := strings.Repeat("x", 20000)
+	for i := 0; i < exportBatchSize; i++ {
+		isbn := fmt.Sprintf("978%010d", i)
+		books.AddRow(isbn, user.LibID)
+		editions.AddRow(isbn, long, long)
+	}
+	mock.ExpectQuery(`SELECT .* FROM "books" JOIN editions ON editions.isbn = books.isbn`).WillReturnRows(books)
+	mock.ExpectQuery(`SELECT \* FROM "editions"`).WillReturnRows(editions)
+	mock.ExpectQuery(`SELECT \* FROM "book_copies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isbn", "lib_id", "barcode"}))
+	mock.ExpectQuery(`SELECT .* FROM "books" JOIN editions ON editions.isbn = books.isbn`).
+		WillReturnError(fmt.Errorf("connection reset"))
+
+	ExportBooks(c)
+
+	// Nothing of the workbook was sent, so the failure is still reported.
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "Database error exporting catalog", resp["error"])
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+	leftover, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Empty(t, leftover)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that an unknown export column is rejected before querying.
+func TestExportBooks_UnknownColumn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/admin/books/export?columns=isbn,price", nil)
+	c.Set(string(middlewares.UserContextKey), middlewares.User{ID: 1, Role: "LibraryAdmin", LibID: 1})
+
+	ExportBooks(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, `Unknown export column "price"`, resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectNoHolds expects SearchBooks to find no one waiting for the isbns.
+func expectNoHolds(mock sqlmock.Sqlmock, libID uint, isbns ...driver.Value) {
+	mock.ExpectQuery(`SELECT isbn, count\(\*\) AS waiting FROM "holds"`).
+		WithArgs(append(append([]driver.Value{libID}, isbns...), models.HoldWaiting)...).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "waiting"}))
+}
+
+// expectFacetCounts expects SearchBooks to count each facet, finding no values.
+func expectFacetCounts(mock sqlmock.Sqlmock) {
+	for range catalogFacets {
+		mock.ExpectQuery(`SELECT .* AS value, count\(\*\) AS count FROM "books"`).
+			WillReturnRows(sqlmock.NewRows([]string{"value", "count"}))
+	}
+}
+
+// Test that q is searched as prefixes across the edition, ranked, alongside the field filters.
+func TestSearchBooks_FullText(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reader/books?q=kern%2C+prog%21&publisher=prentice", nil)
+	user := middlewares.User{ID: 2, Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$1 ` +
+		`AND .* @@ to_tsquery\('english', \$2\) AND editions.publisher ILIKE \$3$`).
+		WithArgs(user.LibID, "kern:* & prog:*", "%prentice%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	expectFacetCounts(mock)
+	mock.ExpectQuery(`SELECT .* FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$1 ` +
+		`AND .* @@ to_tsquery\('english', \$2\) AND editions.publisher ILIKE \$3 ` +
+		`ORDER BY \(ts_rank\(.*, to_tsquery\('english', \$4\)\)\) DESC, books.isbn LIMIT \$5`).
+		WithArgs(user.LibID, "kern:* & prog:*", "%prentice%", "kern:* & prog:*", defaultPageSize).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
+			AddRow("9780131103627", user.LibID, 2, 1))
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE "editions"."isbn" = \$1`).
+		WithArgs("9780131103627").
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title", "authors"}).
+			AddRow("9780131103627", "The C Programming Language", "Brian W. Kernighan, Dennis M. Ritchie"))
+	expectNoHolds(mock, user.LibID, "9780131103627")
+
+	SearchBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Books []map[string]interface{} `json:"books"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Books, 1)
+	assert.Equal(t, "The C Programming Language", resp.Books[0]["title"])
+	assert.Equal(t, true, resp.Books[0]["availability"].(map[string]interface{})["available"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that fuzzy mode matches q by trigram word similarity, most similar first.
+func TestSearchBooks_Fuzzy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reader/books?q=Kernigan&fuzzy=true", nil)
+	user := middlewares.User{ID: 2, Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" .* WHERE books.lib_id = \$1 AND \(editions.title %> \$2 OR editions.authors %> \$3\)$`).
+		WithArgs(user.LibID, "Kernigan", "Kernigan").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	expectFacetCounts(mock)
+	mock.ExpectQuery(`SELECT .* FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$1 ` +
+		`AND \(editions.title %> \$2 OR editions.authors %> \$3\) ` +
+		`ORDER BY \(greatest\(word_similarity\(\$4, editions.title\), word_similarity\(\$5, editions.authors\)\)\) DESC, books.isbn LIMIT \$6`).
+		WithArgs(user.LibID, "Kernigan", "Kernigan", "Kernigan", "Kernigan", defaultPageSize).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
+			AddRow("9780131103627", user.LibID, 2, 1))
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE "editions"."isbn" = \$1`).
+		WithArgs("9780131103627").
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title", "authors"}).
+			AddRow("9780131103627", "The C Programming Language", "Brian W. Kernighan, Dennis M. Ritchie"))
+	expectNoHolds(mock, user.LibID, "9780131103627")
+
+	SearchBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"authors":"Brian W. Kernighan, Dennis M. Ritchie"`)
+	assert.NotContains(t, w.Body.String(), "suggestions")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that an exact search finding nothing suggests similar authors held by the library.
+func TestSearchBooks_Suggestions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reader/books?author=Kernigan", nil)
+	user := middlewares.User{ID: 2, Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$1 AND editions.authors ILIKE \$2`).
+		WithArgs(user.LibID, "%Kernigan%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT DISTINCT editions.authors AS value, word_similarity\(\$1, editions.authors\) AS score FROM "books" ` +
+		`JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$2 AND editions.authors %> \$3 ORDER BY score DESC LIMIT \$4`).
+		WithArgs("Kernigan", user.LibID, "Kernigan", maxSuggestions).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "score"}).
+			AddRow("Brian W. Kernighan, Dennis M. Ritchie", 0.7).
+			AddRow("Brian Kernighan, Rob Pike", 0.7))
+
+	SearchBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Books       []map[string]interface{} `json:"books"`
+		Suggestions []map[string]string      `json:"suggestions"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Books)
+	assert.Equal(t, []map[string]string{
+		{"param": "author", "value": "Brian W. Kernighan, Dennis M. Ritchie"},
+		{"param": "author", "value": "Brian Kernighan, Rob Pike"},
+	}, resp.Suggestions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that ListLibraries sorts, pages and links to the next page.
+func TestListLibraries_PageAndSort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/libraries?sort=-name&pageSize=1", nil)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "libraries"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT libraries.id, libraries.name, count\(books.isbn\) AS num_books FROM "libraries" ` +
+		`LEFT JOIN books ON books.lib_id = libraries.id WHERE "libraries"."deleted_at" IS NULL ` +
+		`GROUP BY "libraries"."id" ORDER BY libraries.name DESC, libraries.id ASC LIMIT \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "num_books"}).AddRow(2, "West", 7))
+
+	ListLibraries(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"libraries": [{"id": 2, "name": "West", "numBooks": 7}], "page": 1, "pageSize": 1, "total": 2,
+		"next": "/api/libraries?page=2&pageSize=1&sort=-name"}`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that an unknown sort key is rejected.
+func TestListLibraries_InvalidSort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/libraries?sort=size", nil)
+
+	ListLibraries(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "sort must be one of added, books, name, optionally prefixed with -", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that facets are counted in SQL, each without its own selection, and that selections filter the books.
+func TestSearchBooks_Facets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reader/books?facetPublisher=Prentice+Hall&facetAvailability=available", nil)
+	user := middlewares.User{ID: 2, Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	availability := regexp.QuoteMeta(availabilityValue)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$1 ` +
+		`AND editions.publisher IN \(\$2\) AND ` + availability + ` IN \(\$3\)$`).
+		WithArgs(user.LibID, "Prentice Hall", "available").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT editions.publisher AS value, count\(\*\) AS count FROM "books" JOIN editions ON editions.isbn = books.isbn ` +
+		`WHERE \(books.lib_id = \$1 AND coalesce\(editions.publisher, ''\) <> ''\) AND ` + availability + ` IN \(\$2\) ` +
+		`GROUP BY "value" ORDER BY count DESC, value LIMIT \$3`).
+		WithArgs(user.LibID, "available", maxFacetValues).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("Prentice Hall", 1).AddRow("Addison-Wesley", 4))
+	mock.ExpectQuery(`SELECT author AS value, count\(\*\) AS count FROM "books" JOIN editions ON editions.isbn = books.isbn ` +
+		`CROSS JOIN LATERAL regexp_split_to_table\(editions.authors, '\\s\*,\\s\*'\) AS author ` +
+		`WHERE \(books.lib_id = \$1 AND coalesce\(author, ''\) <> ''\) AND editions.publisher IN \(\$2\) AND ` + availability + ` IN \(\$3\) ` +
+		`GROUP BY "value" ORDER BY count DESC, value LIMIT \$4`).
+		WithArgs(user.LibID, "Prentice Hall", "available", maxFacetValues).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("Brian W. Kernighan", 1).AddRow("Dennis M. Ritchie", 1))
+	mock.ExpectQuery(`SELECT CASE .* AS value, count\(\*\) AS count FROM "books" .* AND editions.publisher IN \(\$2\) GROUP BY`).
+		WithArgs(user.LibID, "Prentice Hall", maxFacetValues).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("available", 1).AddRow("unavailable", 2))
+	mock.ExpectQuery(`SELECT editions.version AS value, count\(\*\) AS count FROM "books"`).
+		WithArgs(user.LibID, "Prentice Hall", "available", maxFacetValues).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("2nd", 1))
+	mock.ExpectQuery(`SELECT .* FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$1 .* ORDER BY editions.title ASC, books.isbn ASC LIMIT \$4`).
+		WithArgs(user.LibID, "Prentice Hall", "available", defaultPageSize).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
+			AddRow("9780131103627", user.LibID, 2, 1))
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE "editions"."isbn" = \$1`).
+		WithArgs("9780131103627").
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title", "publisher"}).
+			AddRow("9780131103627", "The C Programming Language", "Prentice Hall"))
+	expectNoHolds(mock, user.LibID, "9780131103627")
+
+	SearchBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Facets map[string][]facetValue `json:"facets"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, map[string][]facetValue{
+		"publisher":    {{"Prentice Hall", 1}, {"Addison-Wesley", 4}},
+		"author":       {{"Brian W. Kernighan", 1}, {"Dennis M. Ritchie", 1}},
+		"availability": {{"available", 1}, {"unavailable", 2}},
+		"edition":      {{"2nd", 1}},
+	}, resp.Facets)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that only the known availability values can be selected.
+func TestSearchBooks_InvalidFacet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reader/books?facetAvailability=soon", nil)
+	c.Set(string(middlewares.UserContextKey), middlewares.User{ID: 2, Role: "Reader", LibID: 1})
+
+	SearchBooks(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "facetAvailability must be available or unavailable", resp["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Test that availability counts only open loans and waiting holds in the library, in a fixed number of queries.
+func TestSearchBooks_Availability(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, mock := setupTestDB(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reader/books", nil)
+	user := middlewares.User{ID: 2, Role: "Reader", LibID: 1}
+	c.Set(string(middlewares.UserContextKey), user)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books"`).
+		WithArgs(user.LibID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	expectFacetCounts(mock)
+	mock.ExpectQuery(`SELECT .* FROM "books" JOIN editions ON editions.isbn = books.isbn WHERE books.lib_id = \$1 ORDER BY editions.title ASC, books.isbn ASC LIMIT \$2`).
+		WithArgs(user.LibID, defaultPageSize).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "lib_id", "total_copies", "available_copies"}).
+			AddRow("9780131103627", user.LibID, 2, 0).
+			AddRow("9780201633610", user.LibID, 2, 1).
+			AddRow("9780262033848", user.LibID, 1, 0))
+	mock.ExpectQuery(`SELECT \* FROM "editions" WHERE "editions"."isbn" IN \(\$1,\$2,\$3\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "title"}))
+	mock.ExpectQuery(`SELECT isbn, count\(\*\) AS waiting FROM "holds" ` +
+		`WHERE \(lib_id = \$1 AND isbn IN \(\$2,\$3,\$4\) AND status = \$5\) AND "holds"."deleted_at" IS NULL GROUP BY "isbn"`).
+		WithArgs(user.LibID, "9780131103627", "9780201633610", "9780262033848", models.HoldWaiting).
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "waiting"}).AddRow("9780131103627", 3))
+	// Two copies of the first book are out, due on different days.
+	first, second := time.Now().AddDate(0, 0, 3), time.Now().AddDate(0, 0, 5)
+	mock.ExpectQuery(`SELECT "isbn","expected_return_date" FROM "issue_registries" ` +
+		`WHERE \(lib_id = \$1 AND isbn IN \(\$2,\$3\) AND issue_status = \$4\) AND "issue_registries"."deleted_at" IS NULL`).
+		WithArgs(user.LibID, "9780131103627", "9780262033848", "Issued").
+		WillReturnRows(sqlmock.NewRows([]string{"isbn", "expected_return_date"}).
+			AddRow("9780131103627", second).
+			AddRow("9780131103627", first))
+	mock.ExpectQuery(`SELECT \* FROM "circulation_policies" WHERE lib_id = \$1`).
+		WithArgs(user.LibID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"lib_id", "loan_period_days"}).AddRow(user.LibID, 14))
+
+	SearchBooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Books []struct {
+			Availability bookAvailability `json:"availability"`
+		} `json:"books"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	// Three readers are ahead, so the fourth return serves a new reader:
+	// the second copy's next return, a loan period after its first.
+	assert.Equal(t, bookAvailability{
+		NextReturnDate:         formatDate(first),
+		HoldQueueLength:        3,
+		EstimatedAvailableDate: formatDate(second.AddDate(0, 0, 14)),
+	}, resp.Books[0].Availability)
+	assert.Equal(t, bookAvailability{Available: true}, resp.Books[1].Availability)
+	assert.Equal(t, bookAvailability{}, resp.Books[2].Availability)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
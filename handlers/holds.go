@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"lms/backend/config"
+	"lms/backend/middlewares"
+	"lms/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// promoteHolds reserves newly circulating copies of a book for the oldest
+// waiting holds, one copy per hold, and returns how many holds became ready.
+func promoteHolds(tx *gorm.DB, isbn string, libID uint, copies []models.BookCopy) (int, error) {
+	var holds []models.Hold
+	if err := tx.Where("isbn = ? AND lib_id = ? AND status = ?", isbn, libID, models.HoldWaiting).
+		Order("placed_at ASC, id ASC").Limit(len(copies)).Find(&holds).Error; err != nil {
+		return 0, err
+	}
+	if len(holds) == 0 {
+		return 0, nil
+	}
+	policy, err := loadCirculationPolicy(tx, libID)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	expiresAt := now.AddDate(0, 0, policy.HoldPickupDays)
+	for i, hold := range holds {
+		if err := tx.Model(&hold).Updates(map[string]interface{}{
+			"status":     models.HoldReady,
+			"ready_at":   now,
+			"expires_at": expiresAt,
+			"copy_id":    copies[i].ID,
+		}).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Model(&copies[i]).Update("status", models.CopyOnHold).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(holds), nil
+}
+
+// releaseHeldCopy releases the copy reserved for a ready hold.
+func releaseHeldCopy(tx *gorm.DB, hold models.Hold) error {
+	bookCopy, err := findCopy(tx, hold.CopyID, hold.ISBN, hold.LibID, models.CopyOnHold)
+	if err != nil {
+		return err
+	}
+	return releaseCopy(tx, bookCopy)
+}
+
+// holdPosition returns the 1-based place of a waiting hold in its book's queue.
+func holdPosition(db *gorm.DB, hold models.Hold) (int64, error) {
+	var ahead int64
+	err := db.Model(&models.Hold{}).
+		Where("isbn = ? AND lib_id = ? AND status = ? AND (placed_at < ? OR (placed_at = ? AND id < ?))",
+			hold.ISBN, hold.LibID, models.HoldWaiting, hold.PlacedAt, hold.PlacedAt, hold.ID).
+		Count(&ahead).Error
+	return ahead + 1, err
+}
+
+// holdPositions returns the 1-based queue places of a reader's waiting holds
+// in one query, keyed by hold ID. isbns are the books the reader waits for.
+func holdPositions(db *gorm.DB, readerID, libID uint, isbns []string) (map[uint]int64, error) {
+	queues := db.Model(&models.Hold{}).
+		Select("id, reader_id, ROW_NUMBER() OVER (PARTITION BY lib_id, isbn ORDER BY placed_at, id) AS position").
+		Where("lib_id = ? AND isbn IN ? AND status = ?", libID, isbns, models.HoldWaiting)
+	var rows []struct {
+		ID       uint
+		Position int64
+	}
+	if err := db.Table("(?) AS queues", queues).Select("id, position").
+		Where("reader_id = ?", readerID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	positions := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		positions[row.ID] = row.Position
+	}
+	return positions, nil
+}
+
+// ExpireHolds expires ready holds whose pickup window has passed and passes
+// their reserved copies on to the next reader in the queue.
+func ExpireHolds(db *gorm.DB) error {
+	var holds []models.Hold
+	if err := db.Where("status = ? AND expires_at < ?", models.HoldReady, time.Now()).Find(&holds).Error; err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.Hold{}).
+				Where("id = ? AND status = ?", hold.ID, models.HoldReady).
+				Update("status", models.HoldExpired)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			return releaseHeldCopy(tx, hold)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PlaceHold adds the reader to the queue for a book with no available copies.
+func PlaceHold(c *gin.Context) {
+	var req RaiseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing ISBN in request"})
+		return
+	}
+	isbn, ok := parseISBN(c, req.ISBN)
+	if !ok {
+		return
+	}
+	req.ISBN = isbn
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+	libID := user.LibID
+
+	var book models.Book
+	if err := config.DB.Where("isbn = ? AND lib_id = ?", req.ISBN, libID).First(&book).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+	if book.AvailableCopies > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Book is available, please raise an issue request instead"})
+		return
+	}
+
+	var existingIssue models.IssueRegistry
+	err := config.DB.Where("isbn = ? AND reader_id = ? AND issue_status = ?", req.ISBN, user.ID, "Issued").First(&existingIssue).Error
+	if err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already have an issued copy of this book"})
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking active issues"})
+		return
+	}
+
+	var existingHold models.Hold
+	err = config.DB.Where("isbn = ? AND lib_id = ? AND reader_id = ? AND status IN ?", req.ISBN, libID, user.ID,
+		[]string{models.HoldWaiting, models.HoldReady}).First(&existingHold).Error
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a hold on this book"})
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking existing holds"})
+		return
+	}
+
+	hold := models.Hold{
+		ISBN:     req.ISBN,
+		LibID:    libID,
+		ReaderID: user.ID,
+		Status:   models.HoldWaiting,
+		PlacedAt: time.Now(),
+	}
+	// A concurrent request may have queued the reader since the check above;
+	// the unique index on active holds lets only one of them in.
+	res := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&hold)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error placing hold"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a hold on this book"})
+		return
+	}
+	position, err := holdPosition(config.DB, hold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error computing queue position"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Hold placed successfully", "hold": hold, "position": position})
+}
+
+// ListHolds lists the reader's waiting and ready holds with their queue position.
+func ListHolds(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	var holds []models.Hold
+	if err := config.DB.Where("reader_id = ? AND lib_id = ? AND status IN ?", user.ID, user.LibID,
+		[]string{models.HoldWaiting, models.HoldReady}).Order("placed_at ASC").Find(&holds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching holds"})
+		return
+	}
+
+	var waiting []string
+	for _, hold := range holds {
+		if hold.Status == models.HoldWaiting {
+			waiting = append(waiting, hold.ISBN)
+		}
+	}
+	positions := map[uint]int64{}
+	if len(waiting) > 0 {
+		var err error
+		if positions, err = holdPositions(config.DB, user.ID, user.LibID, waiting); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error computing queue position"})
+			return
+		}
+	}
+
+	result := []gin.H{}
+	for _, hold := range holds {
+		entry := gin.H{
+			"id":        hold.ID,
+			"isbn":      hold.ISBN,
+			"status":    hold.Status,
+			"placedAt":  hold.PlacedAt,
+			"expiresAt": hold.ExpiresAt,
+		}
+		if hold.Status == models.HoldWaiting {
+			entry["position"] = positions[hold.ID]
+		}
+		result = append(result, entry)
+	}
+	c.JSON(http.StatusOK, gin.H{"holds": result})
+}
+
+// CancelHold removes one of the reader's holds from the queue.
+func CancelHold(c *gin.Context) {
+	holdID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return
+	}
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	tx := config.DB.Begin()
+
+	var hold models.Hold
+	if err := tx.Where("id = ? AND reader_id = ?", holdID, user.ID).First(&hold).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hold not found"})
+		return
+	}
+	if hold.Status != models.HoldWaiting && hold.Status != models.HoldReady {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hold is no longer active"})
+		return
+	}
+	res := tx.Model(&models.Hold{}).
+		Where("id = ? AND status = ?", hold.ID, hold.Status).
+		Update("status", models.HoldCancelled)
+	if res.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error cancelling hold"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Hold changed, please retry"})
+		return
+	}
+	// A copy reserved for this reader moves on to the next one in the queue.
+	if hold.Status == models.HoldReady {
+		if err := releaseHeldCopy(tx, hold); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error releasing reserved copy"})
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Hold cancelled"})
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lms/backend/config"
+	"lms/backend/isbn"
+	"lms/backend/marc"
+	"lms/backend/middlewares"
+	"lms/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Outcomes reported for each row of a catalog import.
+const (
+	importCreated     = "created"
+	importIncremented = "incremented"
+	importInvalid     = "invalid"
+	importConflict    = "conflict"
+)
+
+// Catalog file formats accepted by ImportBooks.
+const (
+	formatCSV     = "csv"
+	formatMARC    = "marc"
+	formatMARCXML = "marcxml"
+)
+
+// maxImportSize caps the size of an uploaded catalog file.
+const maxImportSize = 10 << 20
+
+// ImportRowResult is the outcome of one imported row. Row is the line in a
+// CSV file, counting the header as line 1, or the record number in a MARC
+// file.
+type ImportRowResult struct {
+	Row     int    `json:"row"`
+	ISBN    string `json:"isbn,omitempty"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// importRow is a parsed CSV row. Rows that cannot become an AddBookRequest
+// keep the reason in err.
+type importRow struct {
+	line int
+	req  AddBookRequest
+	err  string
+}
+
+// readImportRows parses a catalog CSV whose header names the ISBN, Title,
+// Authors, Publisher, Version and Copies columns in any order and case. Only
+// ISBN and Copies are required. A malformed file is returned as an error.
+func readImportRows(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"isbn", "copies"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", name)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV: %v", err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: line, req: AddBookRequest{
+			ISBN:      field("isbn"),
+			Title:     field("title"),
+			Authors:   field("authors"),
+			Publisher: field("publisher"),
+			Version:   field("version"),
+		}}
+		if normalized, err := isbn.Normalize(row.req.ISBN); err != nil {
+			row.err = "Invalid ISBN: " + err.Error()
+		} else if copies, err := strconv.Atoi(field("copies")); err != nil || copies <= 0 {
+			row.req.ISBN = normalized
+			row.err = "Copies must be a positive whole number"
+		} else {
+			row.req.ISBN = normalized
+			row.req.Copies = copies
+		}
+		rows = append(rows, row)
+	}
+}
+
+// marcRecordReader is implemented by marc.Reader and marc.XMLReader.
+type marcRecordReader interface {
+	Read() (*marc.Record, error)
+}
+
+// readMARCRows turns MARC records into import rows numbered from 1. Each 852
+// holdings field becomes a copy with its barcode and shelf location; a record
+// without holdings adds one copy.
+func readMARCRows(r marcRecordReader) ([]importRow, error) {
+	var rows []importRow
+	for n := 1; ; n++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid MARC file: %v", err)
+		}
+
+		book := marc.BookFromRecord(rec)
+		row := importRow{line: n, req: AddBookRequest{
+			ISBN:      book.ISBN,
+			Title:     book.Title,
+			Authors:   book.Authors,
+			Publisher: book.Publisher,
+			Version:   book.Version,
+			Copies:    1,
+		}}
+		if len(book.Items) > 0 {
+			row.req.Copies = len(book.Items)
+			row.req.ShelfLocation = book.Items[0].ShelfLocation
+			for _, item := range book.Items {
+				row.req.Items = append(row.req.Items, CopyInput{Barcode: item.Barcode, ShelfLocation: item.ShelfLocation})
+			}
+		}
+		if book.ISBN == "" {
+			row.err = "Record has no ISBN in field 020"
+		} else if normalized, err := isbn.Normalize(book.ISBN); err != nil {
+			row.err = "Invalid ISBN: " + err.Error()
+		} else {
+			row.req.ISBN = normalized
+		}
+		rows = append(rows, row)
+	}
+}
+
+// importFormat picks the format of an uploaded file from the format query
+// parameter, then its content type, then its file name.
+func importFormat(format, contentType, filename string) (string, bool) {
+	if format != "" {
+		return format, format == formatCSV || format == formatMARC || format == formatMARCXML
+	}
+	switch contentType {
+	case "application/marc":
+		return formatMARC, true
+	case "application/marcxml+xml", "application/xml", "text/xml":
+		return formatMARCXML, true
+	}
+	switch {
+	case strings.HasSuffix(filename, ".mrc"), strings.HasSuffix(filename, ".marc"):
+		return formatMARC, true
+	case strings.HasSuffix(filename, ".xml"):
+		return formatMARCXML, true
+	}
+	return formatCSV, true
+}
+
+// editionConflict describes how a row's metadata disagrees with the edition
+// already catalogued for its ISBN. Blank columns never conflict.
+func editionConflict(edition models.Edition, req AddBookRequest) string {
+	fields := []struct{ name, given, current string }{
+		{"Title", req.Title, edition.Title},
+		{"Authors", req.Authors, edition.Authors},
+		{"Publisher", req.Publisher, edition.Publisher},
+		{"Version", req.Version, edition.Version},
+	}
+	for _, f := range fields {
+		if f.given != "" && f.given != f.current {
+			return fmt.Sprintf("%s %q differs from the catalogued %q", f.name, f.given, f.current)
+		}
+	}
+	return ""
+}
+
+// importBookRow applies one row inside tx. Only database failures are
+// returned as errors; everything else is reported in the result.
+func importBookRow(tx *gorm.DB, libID uint, row importRow) (ImportRowResult, error) {
+	result := ImportRowResult{Row: row.line, ISBN: row.req.ISBN}
+	if row.err != "" {
+		result.Outcome, result.Error = importInvalid, row.err
+		return result, nil
+	}
+
+	var barcodes []string
+	seen := map[string]bool{}
+	for _, item := range row.req.Items {
+		if item.Barcode == "" {
+			continue
+		}
+		if seen[item.Barcode] {
+			result.Outcome, result.Error = importInvalid, fmt.Sprintf("Barcode %s is repeated", item.Barcode)
+			return result, nil
+		}
+		seen[item.Barcode] = true
+		barcodes = append(barcodes, item.Barcode)
+	}
+
+	var edition models.Edition
+	err := tx.Where("isbn = ?", row.req.ISBN).First(&edition).Error
+	if err == nil {
+		if conflict := editionConflict(edition, row.req); conflict != "" {
+			result.Outcome, result.Error = importConflict, conflict
+			return result, nil
+		}
+	} else if err != gorm.ErrRecordNotFound {
+		return result, err
+	}
+
+	// Barcodes are unique across libraries, so a reused one would fail the
+	// whole transaction. Deleted copies keep their barcodes too.
+	if len(barcodes) > 0 {
+		var existing models.BookCopy
+		err := tx.Unscoped().Where("barcode IN ?", barcodes).First(&existing).Error
+		if err == nil {
+			result.Outcome, result.Error = importConflict, fmt.Sprintf("Barcode %s is already in use", existing.Barcode)
+			return result, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return result, err
+		}
+	}
+
+	created, err := addBookCopies(tx, libID, row.req)
+	switch {
+	case err == errEditionRequired:
+		result.Outcome, result.Error = importInvalid, err.Error()
+	case err != nil:
+		return result, err
+	case created:
+		result.Outcome = importCreated
+	default:
+		result.Outcome = importIncremented
+	}
+	return result, nil
+}
+
+// ImportBooks adds books to the admin's library from a CSV, binary MARC 21 or
+// MARCXML file, uploaded as the "file" field of a multipart form or as the
+// request body. The format comes from the format parameter, the content type
+// or the file name, and defaults to CSV. Each row or record is applied like
+// POST /admin/books; rows whose metadata disagrees with the catalogued
+// edition, or whose barcodes are taken, are reported as conflicts and skipped.
+//
+// With dryRun=true the rows are applied in a transaction that is rolled back,
+// so the report shows exactly what the import would do. Otherwise the import
+// runs in one transaction, or commits every chunkSize rows. If a chunk fails
+// the response names the row to pass as startRow to resume.
+func ImportBooks(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dryRun must be true or false"})
+		return
+	}
+	chunkSize, err := strconv.Atoi(c.DefaultQuery("chunkSize", "0"))
+	if err != nil || chunkSize < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chunkSize must be a non-negative integer"})
+		return
+	}
+	startRow, err := strconv.Atoi(c.DefaultQuery("startRow", "1"))
+	if err != nil || startRow < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "startRow must be a positive integer"})
+		return
+	}
+	if dryRun {
+		chunkSize = 0
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	var file io.Reader = c.Request.Body
+	contentType, filename := c.ContentType(), ""
+	if strings.HasPrefix(contentType, "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing import file"})
+			return
+		}
+		upload, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read import file"})
+			return
+		}
+		defer upload.Close()
+		file = upload
+		contentType = strings.TrimSpace(strings.Split(header.Header.Get("Content-Type"), ";")[0])
+		filename = strings.ToLower(header.Filename)
+	}
+	format, ok := importFormat(c.Query("format"), contentType, filename)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, marc or marcxml"})
+		return
+	}
+
+	var rows []importRow
+	switch format {
+	case formatMARC:
+		rows, err = readMARCRows(marc.NewReader(file))
+	case formatMARCXML:
+		rows, err = readMARCRows(marc.NewXMLReader(file))
+	default:
+		rows, err = readImportRows(file)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var pending []importRow
+	for _, row := range rows {
+		if row.line >= startRow {
+			pending = append(pending, row)
+		}
+	}
+
+	results := make([]ImportRowResult, 0, len(pending))
+	summary := map[string]int{importCreated: 0, importIncremented: 0, importInvalid: 0, importConflict: 0}
+	// Rows before startRow were committed by an earlier, interrupted import.
+	committedThrough := startRow - 1
+	for len(pending) > 0 {
+		size := len(pending)
+		if chunkSize > 0 && chunkSize < size {
+			size = chunkSize
+		}
+		chunk := pending[:size]
+
+		tx := config.DB.Begin()
+		chunkResults := make([]ImportRowResult, 0, size)
+		for _, row := range chunk {
+			result, err := importBookRow(tx, user.LibID, row)
+			if err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":            fmt.Sprintf("Database error importing row %d", row.line),
+					"resumeFrom":       chunk[0].line,
+					"committedThrough": committedThrough,
+					"summary":          summary,
+					"rows":             results,
+				})
+				return
+			}
+			chunkResults = append(chunkResults, result)
+		}
+		if dryRun {
+			tx.Rollback()
+		} else if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":            "Transaction commit error",
+				"resumeFrom":       chunk[0].line,
+				"committedThrough": committedThrough,
+				"summary":          summary,
+				"rows":             results,
+			})
+			return
+		} else {
+			committedThrough = chunk[size-1].line
+		}
+
+		for _, result := range chunkResults {
+			summary[result.Outcome]++
+		}
+		results = append(results, chunkResults...)
+		pending = pending[size:]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dryRun":           dryRun,
+		"committedThrough": committedThrough,
+		"summary":          summary,
+		"rows":             results,
+	})
+}
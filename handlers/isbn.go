@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"lms/backend/isbn"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseISBN converts an ISBN from a path parameter or request body into the
+// canonical ISBN-13 the catalog is keyed on. It writes a 400 response and
+// returns false if the ISBN is invalid.
+func parseISBN(c *gin.Context, raw string) (string, bool) {
+	normalized, err := isbn.Normalize(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN: " + err.Error()})
+		return "", false
+	}
+	return normalized, true
+}
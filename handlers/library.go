@@ -10,10 +10,11 @@ import (
 )
 
 type CreateLibraryRequest struct {
-	LibraryName  string `json:"libraryName" binding:"required"`
-	OwnerName    string `json:"OwnerName" binding:"required"`
-	OwnerEmail   string `json:"ownerEmail" binding:"required,email"`
-	OwnerContact string `json:"ownerContact"`
+	LibraryName   string `json:"libraryName" binding:"required"`
+	OwnerName     string `json:"OwnerName" binding:"required"`
+	OwnerEmail    string `json:"ownerEmail" binding:"required,email"`
+	OwnerContact  string `json:"ownerContact"`
+	OwnerPassword string `json:"ownerPassword" binding:"required,min=8"`
 }
 
 // creates a new library and registers the owner.
@@ -31,6 +32,12 @@ func CreateLibrary(c *gin.Context) {
 		return
 	}
 
+	passwordHash, err := hashPassword(req.OwnerPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+		return
+	}
+
 	// Create new library.
 	newLib := models.Library{Name: req.LibraryName}
 	if err := config.DB.Create(&newLib).Error; err != nil {
@@ -45,6 +52,7 @@ func CreateLibrary(c *gin.Context) {
 		ContactNumber: req.OwnerContact,
 		Role:          "Owner",
 		LibID:         newLib.ID,
+		PasswordHash:  passwordHash,
 	}
 	if err := config.DB.Create(&owner).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error creating owner user"})
@@ -54,23 +62,54 @@ func CreateLibrary(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "Library created successfully", "libraryId": newLib.ID})
 }
 
+// librarySorts are the sort keys of ListLibraries.
+var librarySorts = map[string]string{
+	"name":  "libraries.name",
+	"added": "libraries.created_at",
+	"books": "num_books",
+}
+
+// ListLibraries lists the libraries with their number of books, a page at a
+// time, by name unless ?sort= says otherwise.
 func ListLibraries(c *gin.Context) {
-	var libraries []models.Library
-	if err := config.DB.Find(&libraries).Error; err != nil {
+	page, pageSize, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	order, ok := parseSort(c, librarySorts, "name", "libraries.id ASC")
+	if !ok {
+		return
+	}
+
+	query := config.DB.Model(&models.Library{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch libraries"})
+		return
+	}
+	// The book counts come from the same query as the page of libraries.
+	var libraries []struct {
+		ID       uint
+		Name     string
+		NumBooks int64
+	}
+	if err := paginate(query, page, pageSize).
+		Select("libraries.id, libraries.name, count(books.isbn) AS num_books").
+		Joins("LEFT JOIN books ON books.lib_id = libraries.id").
+		Group("libraries.id").Order(order).Scan(&libraries).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch libraries"})
 		return
 	}
 
-	var result []gin.H
+	result := []gin.H{}
 	for _, lib := range libraries {
-		var count int64
-		config.DB.Model(&models.Book{}).Where("lib_id = ?", lib.ID).Count(&count)
 		result = append(result, gin.H{
 			"id":       lib.ID,
 			"name":     lib.Name,
-			"numBooks": count,
+			"numBooks": lib.NumBooks,
 		})
 	}
 
-	c.JSON(http.StatusOK, gin.H{"libraries": result})
+	c.JSON(http.StatusOK, gin.H{"libraries": result, "page": page, "pageSize": pageSize, "total": total,
+		"next": nextPage(c, page, pageSize, total)})
 }
\ No newline at end of file
@@ -0,0 +1,127 @@
+//go:build integration
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+
+	"lms/backend/config"
+	"lms/backend/middlewares"
+	"lms/backend/models"
+)
+
+// Run these with
+//
+//	TEST_DATABASE_URL=... go test -tags integration -run '^$' -bench . ./handlers
+//
+// Each reports queries/op and fails if a request issues more queries than
+// expected, whatever the size of the seeded data.
+
+// queryCounter is a GORM logger that counts the statements it traces.
+type queryCounter struct {
+	logger.Interface
+	queries atomic.Int64
+}
+
+func (q *queryCounter) LogMode(logger.LogLevel) logger.Interface { return q }
+
+func (q *queryCounter) Trace(context.Context, time.Time, func() (string, int64), error) {
+	q.queries.Add(1)
+}
+
+// countQueries makes config.DB count its statements.
+func countQueries() *queryCounter {
+	counter := &queryCounter{Interface: logger.Discard}
+	config.DB = config.DB.Session(&gorm.Session{Logger: counter})
+	return counter
+}
+
+// seedCatalog gives a new library the given number of books, every other one
+// with no copy available and on loan. Libraries share the editions.
+func seedCatalog(b *testing.B, db *gorm.DB, books int) models.Library {
+	library := models.Library{Name: fmt.Sprintf("Library %d", time.Now().UnixNano())}
+	require.NoError(b, db.Create(&library).Error)
+	reader := models.User{Name: "Reader", Email: fmt.Sprintf("reader%d@example.com", library.ID), Role: "Reader", LibID: library.ID}
+	require.NoError(b, db.Create(&reader).Error)
+
+	editions := make([]models.Edition, books)
+	holdings := make([]models.Book, books)
+	var loans []models.IssueRegistry
+	for i := range editions {
+		isbn := fmt.Sprintf("978%010d", i)
+		editions[i] = models.Edition{ISBN: isbn, Title: fmt.Sprintf("Book %d", i), Authors: fmt.Sprintf("Author %d", i%7),
+			Publisher: fmt.Sprintf("Publisher %d", i%5)}
+		holdings[i] = models.Book{ISBN: isbn, LibID: library.ID, TotalCopies: 1, AvailableCopies: 1}
+		if i%2 == 1 {
+			holdings[i].AvailableCopies = 0
+			loans = append(loans, models.IssueRegistry{ISBN: isbn, LibID: library.ID, ReaderID: reader.ID,
+				IssueStatus: "Issued", IssueDate: time.Now(), ExpectedReturnDate: time.Now().AddDate(0, 0, 14)})
+		}
+	}
+	require.NoError(b, db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(editions, 500).Error)
+	require.NoError(b, db.CreateInBatches(holdings, 500).Error)
+	require.NoError(b, db.CreateInBatches(loans, 500).Error)
+	return library
+}
+
+// benchmarkQueries runs handler on path as user, failing if any request
+// issues other than want queries.
+func benchmarkQueries(b *testing.B, handler gin.HandlerFunc, path string, user middlewares.User, want int64) {
+	gin.SetMode(gin.TestMode)
+	counter := countQueries()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		before := counter.queries.Load()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", path, nil)
+		c.Set(string(middlewares.UserContextKey), user)
+		handler(c)
+		if w.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		if got := counter.queries.Load() - before; got != want {
+			b.Fatalf("request issued %d queries, want %d", got, want)
+		}
+	}
+	b.ReportMetric(float64(counter.queries.Load())/float64(b.N), "queries/op")
+}
+
+// SearchBooks counts the results, counts each facet, then loads the page,
+// its editions, its hold queues, the open loans of its unavailable books and
+// the circulation policy.
+func BenchmarkSearchBooks(b *testing.B) {
+	for _, books := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("books=%d", books), func(b *testing.B) {
+			db := setupIntegrationDB(b)
+			library := seedCatalog(b, db, books)
+			reader := middlewares.User{ID: 1, Role: "Reader", LibID: library.ID}
+			benchmarkQueries(b, SearchBooks, "/api/reader/books?pageSize=100", reader, int64(6+len(catalogFacets)))
+		})
+	}
+}
+
+// ListLibraries counts the libraries, then loads the page with book counts.
+func BenchmarkListLibraries(b *testing.B) {
+	for _, libraries := range []int{10, 50, 100} {
+		b.Run(fmt.Sprintf("libraries=%d", libraries), func(b *testing.B) {
+			db := setupIntegrationDB(b)
+			for i := 0; i < libraries; i++ {
+				seedCatalog(b, db, 3)
+			}
+			benchmarkQueries(b, ListLibraries, "/api/libraries?pageSize=100", middlewares.User{}, 2)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePage reads the page and pageSize query parameters, defaulting to the
+// first page. It writes a 400 response and returns false if either is invalid.
+func parsePage(c *gin.Context) (page, pageSize int, ok bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+		return 0, 0, false
+	}
+	pageSize, err = strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pageSize must be between 1 and " + strconv.Itoa(maxPageSize)})
+		return 0, 0, false
+	}
+	return page, pageSize, true
+}
+
+// paginate limits a query to the given page.
+func paginate(db *gorm.DB, page, pageSize int) *gorm.DB {
+	return db.Offset((page - 1) * pageSize).Limit(pageSize)
+}
+
+// nextPage returns the URL of the page after this one, with the request's
+// other parameters unchanged, or nil on the last page.
+func nextPage(c *gin.Context, page, pageSize int, total int64) *string {
+	if int64(page)*int64(pageSize) >= total {
+		return nil
+	}
+	query := c.Request.URL.Query()
+	query.Set("page", strconv.Itoa(page+1))
+	query.Set("pageSize", strconv.Itoa(pageSize))
+	next := c.Request.URL.Path + "?" + query.Encode()
+	return &next
+}
+
+// parseSort reads the sort query parameter: one of the keys of columns, with
+// a leading "-" for descending order. Without it def is used. The returned
+// ORDER BY ends with tieBreak so pages never overlap. It writes a 400
+// response and returns false if the key is unknown.
+func parseSort(c *gin.Context, columns map[string]string, def, tieBreak string) (string, bool) {
+	param := c.DefaultQuery("sort", def)
+	key, direction := strings.TrimPrefix(param, "-"), "ASC"
+	if strings.HasPrefix(param, "-") {
+		direction = "DESC"
+	}
+	column, ok := columns[key]
+	if !ok {
+		keys := make([]string, 0, len(columns))
+		for k := range columns {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of " + strings.Join(keys, ", ") + ", optionally prefixed with -"})
+		return "", false
+	}
+	return column + " " + direction + ", " + tieBreak, true
+}
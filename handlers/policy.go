@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"lms/backend/config"
+	"lms/backend/middlewares"
+	"lms/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpdatePolicyRequest defines the payload for editing a library's circulation policy.
+// Omitted fields keep their current value.
+type UpdatePolicyRequest struct {
+	LoanPeriodDays     *int   `json:"loanPeriodDays" binding:"omitempty,gt=0"`
+	MaxLoans           *int   `json:"maxLoans" binding:"omitempty,gt=0"`
+	MaxCopiesPerTitle  *int   `json:"maxCopiesPerTitle" binding:"omitempty,gt=0"`
+	MaxPendingRequests *int   `json:"maxPendingRequests" binding:"omitempty,gt=0"`
+	MaxRenewals        *int   `json:"maxRenewals" binding:"omitempty,gte=0"`
+	GraceDays          *int   `json:"graceDays" binding:"omitempty,gte=0"`
+	HoldPickupDays     *int   `json:"holdPickupDays" binding:"omitempty,gt=0"`
+	FinePerDay         *int64 `json:"finePerDay" binding:"omitempty,gte=0"`
+	MaxFineBalance     *int64 `json:"maxFineBalance" binding:"omitempty,gte=0"`
+}
+
+// loadCirculationPolicy returns the library's stored policy or the defaults.
+func loadCirculationPolicy(db *gorm.DB, libID uint) (models.CirculationPolicy, error) {
+	var policy models.CirculationPolicy
+	err := db.Where("lib_id = ?", libID).First(&policy).Error
+	if err == gorm.ErrRecordNotFound {
+		return models.DefaultCirculationPolicy(libID), nil
+	}
+	return policy, err
+}
+
+// checkLoanPolicy reports why the policy refuses another loan of isbn to the
+// reader, or an empty string when the loan is allowed.
+func checkLoanPolicy(db *gorm.DB, policy models.CirculationPolicy, readerID uint, isbn string) (string, error) {
+	var activeLoans int64
+	if err := db.Model(&models.IssueRegistry{}).
+		Where("reader_id = ? AND issue_status = ?", readerID, "Issued").
+		Count(&activeLoans).Error; err != nil {
+		return "", err
+	}
+	if activeLoans >= int64(policy.MaxLoans) {
+		return fmt.Sprintf("Maximum of %d active loans reached", policy.MaxLoans), nil
+	}
+
+	var sameTitle int64
+	if err := db.Model(&models.IssueRegistry{}).
+		Where("isbn = ? AND reader_id = ? AND issue_status = ?", isbn, readerID, "Issued").
+		Count(&sameTitle).Error; err != nil {
+		return "", err
+	}
+	if sameTitle >= int64(policy.MaxCopiesPerTitle) {
+		return fmt.Sprintf("Maximum of %d issued copies of this book reached", policy.MaxCopiesPerTitle), nil
+	}
+
+	// Loans overdue beyond the grace period block further borrowing.
+	var overdue int64
+	if err := db.Model(&models.IssueRegistry{}).
+		Where("reader_id = ? AND issue_status = ? AND expected_return_date < ?",
+			readerID, "Issued", time.Now().AddDate(0, 0, -policy.GraceDays)).
+		Count(&overdue).Error; err != nil {
+		return "", err
+	}
+	if overdue > 0 {
+		return "Overdue books must be returned before borrowing more", nil
+	}
+	return "", nil
+}
+
+// GetCirculationPolicy returns the circulation policy of the user's library.
+func GetCirculationPolicy(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	policy, err := loadCirculationPolicy(config.DB, user.LibID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+// UpdateCirculationPolicy lets the library owner change the circulation policy.
+func UpdateCirculationPolicy(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+	if user.Role != "Owner" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the library owner can change the circulation policy"})
+		return
+	}
+
+	var req UpdatePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy values"})
+		return
+	}
+
+	// The policy is upserted on lib_id so two owners saving at once cannot both
+	// insert a row. A library without a stored policy starts from the defaults;
+	// otherwise only the fields in the request are changed. Maps are used so
+	// that zero values are written rather than replaced by column defaults.
+	defaults := models.DefaultCirculationPolicy(user.LibID)
+	now := time.Now()
+	row := map[string]interface{}{
+		"created_at":           now,
+		"updated_at":           now,
+		"lib_id":               user.LibID,
+		"loan_period_days":     defaults.LoanPeriodDays,
+		"max_loans":            defaults.MaxLoans,
+		"max_copies_per_title": defaults.MaxCopiesPerTitle,
+		"max_pending_requests": defaults.MaxPendingRequests,
+		"max_renewals":         defaults.MaxRenewals,
+		"grace_days":           defaults.GraceDays,
+		"hold_pickup_days":     defaults.HoldPickupDays,
+		"fine_per_day":         defaults.FinePerDay,
+		"max_fine_balance":     defaults.MaxFineBalance,
+	}
+	changes := map[string]interface{}{"updated_at": now}
+	if req.LoanPeriodDays != nil {
+		row["loan_period_days"] = *req.LoanPeriodDays
+		changes["loan_period_days"] = *req.LoanPeriodDays
+	}
+	if req.MaxLoans != nil {
+		row["max_loans"] = *req.MaxLoans
+		changes["max_loans"] = *req.MaxLoans
+	}
+	if req.MaxCopiesPerTitle != nil {
+		row["max_copies_per_title"] = *req.MaxCopiesPerTitle
+		changes["max_copies_per_title"] = *req.MaxCopiesPerTitle
+	}
+	if req.MaxPendingRequests != nil {
+		row["max_pending_requests"] = *req.MaxPendingRequests
+		changes["max_pending_requests"] = *req.MaxPendingRequests
+	}
+	if req.MaxRenewals != nil {
+		row["max_renewals"] = *req.MaxRenewals
+		changes["max_renewals"] = *req.MaxRenewals
+	}
+	if req.GraceDays != nil {
+		row["grace_days"] = *req.GraceDays
+		changes["grace_days"] = *req.GraceDays
+	}
+	if req.HoldPickupDays != nil {
+		row["hold_pickup_days"] = *req.HoldPickupDays
+		changes["hold_pickup_days"] = *req.HoldPickupDays
+	}
+	if req.FinePerDay != nil {
+		row["fine_per_day"] = *req.FinePerDay
+		changes["fine_per_day"] = *req.FinePerDay
+	}
+	if req.MaxFineBalance != nil {
+		row["max_fine_balance"] = *req.MaxFineBalance
+		changes["max_fine_balance"] = *req.MaxFineBalance
+	}
+	if err := config.DB.Model(&models.CirculationPolicy{}).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "lib_id"}},
+		DoUpdates: clause.Assignments(changes),
+	}).Create(row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error saving policy"})
+		return
+	}
+	policy, err := loadCirculationPolicy(config.DB, user.LibID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Circulation policy updated", "policy": policy})
+}
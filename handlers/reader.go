@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"lms/backend/config"
@@ -12,60 +14,100 @@ import (
 	"gorm.io/gorm"
 )
 
-// search for books by title, author, or publisher.
+// bookSorts are the sort keys of SearchBooks.
+var bookSorts = map[string]string{
+	"title":        "editions.title",
+	"authors":      "editions.authors",
+	"added":        "books.created_at",
+	"availability": "books.available_copies",
+}
+
+// search for books by keywords across title, authors and publisher (q),
+// ranked by relevance, optionally narrowed by title, author or publisher.
+// fuzzy=true tolerates misspellings in q, title and author. When an exact
+// search finds nothing, the response suggests similar titles and authors.
+// Results come a page at a time; ?sort= orders them by a field instead of
+// relevance, and by title when there is nothing to rank by. Alongside them
+// are counts by publisher, author, availability and edition, which the
+// facetPublisher, facetAuthor, facetAvailability and facetEdition
+// parameters select from.
+// Each book's availability counts only open loans and the hold queue in the
+// reader's library.
 func SearchBooks(c *gin.Context) {
 	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
 	libID := user.LibID
+	page, pageSize, ok := parsePage(c)
+	if !ok {
+		return
+	}
 
-	title := c.Query("title")
-	author := c.Query("author")
-	publisher := c.Query("publisher")
+	search, err := parseCatalogSearch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	var books []models.Book
-	query := config.DB.Where("lib_id = ?", libID)
-	if title != "" {
-		query = query.Where("title ILIKE ?", "%"+title+"%")
+	// Metadata lives on the shared edition; the library's holdings are the books.
+	query := config.DB.Model(&models.Book{}).
+		Joins("JOIN editions ON editions.isbn = books.isbn").
+		Where("books.lib_id = ?", libID).
+		Scopes(search.filter)
+	order := search.rank
+	if c.Query("sort") != "" || !search.ranked() {
+		sort, ok := parseSort(c, bookSorts, "title", "books.isbn ASC")
+		if !ok {
+			return
+		}
+		order = func(db *gorm.DB) *gorm.DB { return db.Order(sort) }
 	}
-	if author != "" {
-		query = query.Where("authors ILIKE ?", "%"+author+"%")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error searching books"})
+		return
 	}
-	if publisher != "" {
-		query = query.Where("publisher ILIKE ?", "%"+publisher+"%")
+	if total == 0 && !search.fuzzy {
+		suggestions, err := search.suggestions(config.DB, libID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error suggesting books"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"books": []gin.H{}, "suggestions": suggestions,
+			"page": page, "pageSize": pageSize, "total": total, "next": nil})
+		return
+	}
+	facets, err := search.facets(config.DB, libID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error counting facets"})
+		return
 	}
-	if err := query.Find(&books).Error; err != nil {
+	var books []models.Book
+	if err := paginate(query.Preload("Edition").Scopes(order), page, pageSize).Find(&books).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error searching books"})
 		return
 	}
 
-	var result []gin.H
+	availability, err := loadAvailability(config.DB, libID, books)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching availability"})
+		return
+	}
+	result := []gin.H{}
 	for _, book := range books {
-		availability := "Available"
-		if book.AvailableCopies <= 0 {
-			var issue models.IssueRegistry
-			err := config.DB.Where("isbn = ?", book.ISBN).Order("expected_return_date ASC").First(&issue).Error
-			if err != nil {
-				if err == gorm.ErrRecordNotFound {
-					availability = "Not available"
-				} else {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching return date"})
-					return
-				}
-			} else {
-				availability = "Not available, expected return: " + issue.ExpectedReturnDate.Format("2006-01-02")
-			}
-		}
 		result = append(result, gin.H{
 			"isbn":             book.ISBN,
-			"title":            book.Title,
-			"authors":          book.Authors,
-			"publisher":        book.Publisher,
-			"version":          book.Version,
+			"title":            book.Edition.Title,
+			"authors":          book.Edition.Authors,
+			"publisher":        book.Edition.Publisher,
+			"version":          book.Edition.Version,
+			"shelf_location":   book.ShelfLocation,
 			"total_copies":     book.TotalCopies,
 			"available_copies": book.AvailableCopies,
-			"availability":     availability,
+			"availability":     availability[book.ISBN],
 		})
 	}
-	c.JSON(http.StatusOK, gin.H{"books": result})
+	c.JSON(http.StatusOK, gin.H{"books": result, "facets": facets, "page": page, "pageSize": pageSize, "total": total,
+		"next": nextPage(c, page, pageSize, total)})
 }
 
 type RaiseRequest struct {
@@ -109,6 +151,11 @@ func RaiseIssueRequest(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Missing ISBN in request"})
         return
     }
+    isbn, ok := parseISBN(c, req.ISBN)
+    if !ok {
+        return
+    }
+    req.ISBN = isbn
     user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
     libID := user.LibID
 
@@ -117,26 +164,48 @@ func RaiseIssueRequest(c *gin.Context) {
         c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
         return
     }
-    if book.AvailableCopies <= 0 {
+    // A reader whose hold is ready may request the copy reserved for them.
+    var readyHold models.Hold
+    err := config.DB.Where("isbn = ? AND lib_id = ? AND reader_id = ? AND status = ?", req.ISBN, libID, user.ID, models.HoldReady).First(&readyHold).Error
+    if err != nil && err != gorm.ErrRecordNotFound {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking holds"})
+        return
+    }
+    if err == gorm.ErrRecordNotFound && book.AvailableCopies <= 0 {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Book is not available for issue"})
         return
     }
 
-    // Check if the reader already has an active issued copy of this book.
-    var existingIssue models.IssueRegistry
-    err := config.DB.Where("isbn = ? AND reader_id = ? AND issue_status = ?", req.ISBN, user.ID, "Issued").First(&existingIssue).Error
-    if err == nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "You already have an issued copy of this book. Please return it before requesting another copy."})
+    // Check the reader's loans against the library's circulation policy.
+    policy, err := loadCirculationPolicy(config.DB, libID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error loading circulation policy"})
         return
     }
-    if err != nil && err != gorm.ErrRecordNotFound {
+    violation, err := checkLoanPolicy(config.DB, policy, user.ID, req.ISBN)
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking active issues"})
         return
     }
+    if violation != "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": violation})
+        return
+    }
+
+    // Readers with too much in unpaid fines cannot borrow more books.
+    balance, err := fineBalance(config.DB, user.ID, libID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking fines"})
+        return
+    }
+    if balance > policy.MaxFineBalance {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Outstanding fines exceed the allowed limit. Please pay them before requesting a book."})
+        return
+    }
 
     // New: Check if there's already a pending request for this book from this user.
     var pendingRequest models.RequestEvent
-    err = config.DB.Where("book_id = ? AND reader_id = ? AND approval_date IS NULL", req.ISBN, user.ID).First(&pendingRequest).Error
+    err = config.DB.Where("book_id = ? AND reader_id = ? AND status = ?", req.ISBN, user.ID, models.RequestPending).First(&pendingRequest).Error
     if err == nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "You already have a pending request for this book. Please wait for admin to process it."})
         return
@@ -145,13 +214,26 @@ func RaiseIssueRequest(c *gin.Context) {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking pending requests"})
         return
     }
+    var pendingCount int64
+    if err := config.DB.Model(&models.RequestEvent{}).
+        Where("reader_id = ? AND request_type = ? AND status = ?", user.ID, "IssueRequest", models.RequestPending).
+        Count(&pendingCount).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking pending requests"})
+        return
+    }
+    if pendingCount >= int64(policy.MaxPendingRequests) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Maximum of %d pending requests reached", policy.MaxPendingRequests)})
+        return
+    }
 
     // Create new request event.
     issueRequest := models.RequestEvent{
         BookID:      req.ISBN,
+        LibID:       libID,
         ReaderID:    user.ID,
         RequestType: "IssueRequest",
         RequestDate: time.Now(),
+        Status:      models.RequestPending,
     }
     if err := config.DB.Create(&issueRequest).Error; err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error raising issue request"})
@@ -160,3 +242,288 @@ func RaiseIssueRequest(c *gin.Context) {
     c.JSON(http.StatusCreated, gin.H{"message": "Issue request raised successfully"})
 }
 
+// RaiseReturnRequest asks an admin to take back a book issued to the reader.
+func RaiseReturnRequest(c *gin.Context) {
+	var req RaiseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing ISBN in request"})
+		return
+	}
+	isbn, ok := parseISBN(c, req.ISBN)
+	if !ok {
+		return
+	}
+	req.ISBN = isbn
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	var issue models.IssueRegistry
+	err := config.DB.Where("isbn = ? AND reader_id = ? AND issue_status = ?", req.ISBN, user.ID, "Issued").First(&issue).Error
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You do not have an issued copy of this book"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking active issues"})
+		return
+	}
+
+	var pendingRequest models.RequestEvent
+	err = config.DB.Where("book_id = ? AND reader_id = ? AND request_type = ? AND status = ?", req.ISBN, user.ID, "ReturnRequest", models.RequestPending).First(&pendingRequest).Error
+	if err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already have a pending return request for this book."})
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking pending requests"})
+		return
+	}
+
+	returnRequest := models.RequestEvent{
+		BookID:      req.ISBN,
+		LibID:       user.LibID,
+		ReaderID:    user.ID,
+		RequestType: "ReturnRequest",
+		RequestDate: time.Now(),
+		Status:      models.RequestPending,
+	}
+	if err := config.DB.Create(&returnRequest).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error raising return request"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Return request raised successfully"})
+}
+
+// RenewIssue extends the due date of one of the reader's issued books by the
+// library's loan period, up to the policy's renewal limit.
+func RenewIssue(c *gin.Context) {
+	issueID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return
+	}
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	tx := config.DB.Begin()
+
+	var issue models.IssueRegistry
+	if err := tx.Where("id = ? AND reader_id = ?", issueID, user.ID).First(&issue).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue record not found"})
+		return
+	}
+	if issue.IssueStatus != "Issued" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only issued books can be renewed"})
+		return
+	}
+
+	policy, err := loadCirculationPolicy(tx, user.LibID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading circulation policy"})
+		return
+	}
+	if issue.RenewalCount >= policy.MaxRenewals {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Renewal limit reached for this book"})
+		return
+	}
+
+	// Renewing is not allowed while another reader is waiting for the book.
+	var waiting int64
+	if err := tx.Model(&models.RequestEvent{}).
+		Where("book_id = ? AND lib_id = ? AND reader_id <> ? AND request_type = ? AND status = ?", issue.ISBN, user.LibID, user.ID, "IssueRequest", models.RequestPending).
+		Count(&waiting).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking pending requests"})
+		return
+	}
+	var queued int64
+	if err := tx.Model(&models.Hold{}).
+		Where("isbn = ? AND lib_id = ? AND status = ?", issue.ISBN, user.LibID, models.HoldWaiting).
+		Count(&queued).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking holds"})
+		return
+	}
+	if waiting > 0 || queued > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Another reader is waiting for this book"})
+		return
+	}
+
+	// Overdue loans are extended from today rather than from the missed due date.
+	base := issue.ExpectedReturnDate
+	if now := time.Now(); now.After(base) {
+		base = now
+	}
+	newDueDate := base.AddDate(0, 0, policy.LoanPeriodDays)
+	res := tx.Model(&models.IssueRegistry{}).
+		Where("id = ? AND issue_status = ? AND renewal_count = ?", issue.ID, "Issued", issue.RenewalCount).
+		Updates(map[string]interface{}{
+			"expected_return_date": newDueDate,
+			"renewal_count":        issue.RenewalCount + 1,
+		})
+	if res.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error renewing issue"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Issue record changed, please retry"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Book renewed successfully",
+		"expectedReturnDate": newDueDate,
+		"renewalCount":       issue.RenewalCount + 1,
+		"renewalsRemaining":  policy.MaxRenewals - issue.RenewalCount - 1,
+	})
+}
+
+// CancelRequest withdraws one of the reader's own pending requests.
+func CancelRequest(c *gin.Context) {
+	reqID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+
+	// Requests raised by other readers are reported as missing.
+	var reqEvent models.RequestEvent
+	if err := config.DB.Where("id = ? AND reader_id = ?", reqID, user.ID).First(&reqEvent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+	if reqEvent.Status != models.RequestPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
+		return
+	}
+	// The status condition stops a request an admin has just processed from being cancelled.
+	res := config.DB.Model(&models.RequestEvent{}).
+		Where("id = ? AND reader_id = ? AND status = ?", reqEvent.ID, user.ID, models.RequestPending).
+		Update("status", models.RequestCancelled)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error cancelling request"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Request cancelled"})
+}
+
+// ListMyRequests lists the reader's issue and return requests, newest first,
+// optionally filtered by ?status=.
+func ListMyRequests(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+	page, pageSize, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	query := config.DB.Model(&models.RequestEvent{}).Where("reader_id = ?", user.ID)
+	if status := c.Query("status"); status != "" {
+		if !validRequestStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status filter"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching requests"})
+		return
+	}
+	var requests []models.RequestEvent
+	if err := paginate(query, page, pageSize).Order("request_date DESC, id DESC").Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching requests"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": requests, "page": page, "pageSize": pageSize, "total": total,
+		"next": nextPage(c, page, pageSize, total)})
+}
+
+// ListMyLoans lists the books currently issued to the reader, soonest due first.
+func ListMyLoans(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+	page, pageSize, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	query := config.DB.Model(&models.IssueRegistry{}).Where("reader_id = ? AND issue_status = ?", user.ID, "Issued")
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching loans"})
+		return
+	}
+	var issues []models.IssueRegistry
+	if err := paginate(query, page, pageSize).Order("expected_return_date ASC, id ASC").Find(&issues).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching loans"})
+		return
+	}
+
+	now := time.Now()
+	loans := []gin.H{}
+	for _, issue := range issues {
+		daysOverdue := 0
+		if now.After(issue.ExpectedReturnDate) {
+			daysOverdue = int(now.Sub(issue.ExpectedReturnDate).Hours() / 24)
+		}
+		loans = append(loans, gin.H{
+			"id":                 issue.ID,
+			"isbn":               issue.ISBN,
+			"issueDate":          issue.IssueDate,
+			"expectedReturnDate": issue.ExpectedReturnDate,
+			"renewalCount":       issue.RenewalCount,
+			"overdue":            now.After(issue.ExpectedReturnDate),
+			"daysOverdue":        daysOverdue,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"loans": loans, "page": page, "pageSize": pageSize, "total": total,
+		"next": nextPage(c, page, pageSize, total)})
+}
+
+// ListMyHistory lists the reader's returned loans, most recent first.
+func ListMyHistory(c *gin.Context) {
+	user := c.MustGet(string(middlewares.UserContextKey)).(middlewares.User)
+	page, pageSize, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	query := config.DB.Model(&models.IssueRegistry{}).Where("reader_id = ? AND issue_status = ?", user.ID, "Returned")
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching history"})
+		return
+	}
+	var issues []models.IssueRegistry
+	if err := paginate(query, page, pageSize).Order("return_date DESC, id DESC").Find(&issues).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching history"})
+		return
+	}
+
+	history := []gin.H{}
+	for _, issue := range issues {
+		history = append(history, gin.H{
+			"id":                 issue.ID,
+			"isbn":               issue.ISBN,
+			"issueDate":          issue.IssueDate,
+			"expectedReturnDate": issue.ExpectedReturnDate,
+			"returnDate":         issue.ReturnDate,
+			"returnedLate":       issue.ReturnDate != nil && issue.ReturnDate.After(issue.ExpectedReturnDate),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history, "page": page, "pageSize": pageSize, "total": total,
+		"next": nextPage(c, page, pageSize, total)})
+}
@@ -1,20 +1,88 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"lms/backend/config"
+	"lms/backend/middlewares"
 	"lms/backend/models"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// errRefreshTokenUsed means a refresh token was revoked by a concurrent request.
+var errRefreshTokenUsed = errors.New("refresh token already used")
+
 // SignInRequest defines the payload for sign in.
 type SignInRequest struct {
-	Email string `json:"email" binding:"required,email"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// RefreshTokenRequest defines the payload for refreshing or revoking a session.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// hashPassword returns the bcrypt hash stored on models.User.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// issueTokens signs an access token for the user and stores a new refresh
+// token. If consume is not nil, it runs first in the same transaction, and the
+// new refresh token is only stored if it succeeds.
+func issueTokens(c *gin.Context, user models.User, consume func(tx *gorm.DB) error) {
+	accessToken, expiresAt, err := middlewares.IssueAccessToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not issue access token"})
+		return
+	}
+	refreshToken, err := middlewares.NewRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not issue refresh token"})
+		return
+	}
+	record := models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: middlewares.HashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().Add(middlewares.RefreshTokenTTL),
+	}
+	if consume == nil {
+		err = config.DB.Create(&record).Error
+	} else {
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := consume(tx); err != nil {
+				return err
+			}
+			return tx.Create(&record).Error
+		})
+	}
+	if errors.Is(err, errRefreshTokenUsed) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error storing refresh token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+		"expiresAt":    expiresAt,
+		"user":         user,
+	})
 }
 
-// SignIn checks if a user exists and returns the user object.
+// SignIn checks the user's credentials and returns a new token pair.
 func SignIn(c *gin.Context) {
 	var req SignInRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -24,9 +92,68 @@ func SignIn(c *gin.Context) {
 
 	var user models.User
 	if err := config.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if user.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	issueTokens(c, user, nil)
+}
+
+// RefreshToken exchanges a valid refresh token for a new token pair.
+// The presented refresh token is revoked so it can only be used once, even
+// when the same token is replayed concurrently.
+func RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	var record models.RefreshToken
+	err := config.DB.Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ?",
+		middlewares.HashRefreshToken(req.RefreshToken), time.Now()).First(&record).Error
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("id = ?", record.UserID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	issueTokens(c, user, func(tx *gorm.DB) error {
+		res := tx.Model(&models.RefreshToken{}).Where("id = ? AND revoked_at IS NULL", record.ID).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return errRefreshTokenUsed
+		}
+		return nil
+	})
+}
+
+// SignOut revokes the given refresh token.
+func SignOut(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(&models.RefreshToken{}).
+		Where("token_hash = ? AND revoked_at IS NULL", middlewares.HashRefreshToken(req.RefreshToken)).
+		Update("revoked_at", &now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error revoking refresh token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Signed out successfully"})
 }
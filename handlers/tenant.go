@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"lms/backend/config"
+	"lms/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Tenant isolation for admin handlers. Admin handlers look requests and issue
+// records up only through the helpers below, which makes a record of another
+// library indistinguishable from a missing one.
+
+// requestsInLibrary restricts a RequestEvent query to the library's requests.
+func requestsInLibrary(libID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("request_events.lib_id = ?", libID)
+	}
+}
+
+// issuesInLibrary restricts an IssueRegistry query to the library's loans.
+func issuesInLibrary(libID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("issue_registries.lib_id = ?", libID)
+	}
+}
+
+// findLibraryRequest loads a request of the library by ID. Requests of other
+// libraries are reported as gorm.ErrRecordNotFound.
+func findLibraryRequest(db *gorm.DB, libID uint, reqID int) (models.RequestEvent, error) {
+	var reqEvent models.RequestEvent
+	err := db.Scopes(requestsInLibrary(libID)).Where("request_events.id = ?", reqID).First(&reqEvent).Error
+	return reqEvent, err
+}
+
+// findLibraryIssue loads an issue record of the library by ID. Issues of other
+// libraries are reported as gorm.ErrRecordNotFound.
+func findLibraryIssue(db *gorm.DB, libID uint, issueID int) (models.IssueRegistry, error) {
+	var issue models.IssueRegistry
+	err := db.Scopes(issuesInLibrary(libID)).Where("issue_registries.id = ?", issueID).First(&issue).Error
+	return issue, err
+}
+
+// findLibraryReader loads a reader of the admin's library from the :id route parameter.
+func findLibraryReader(c *gin.Context, libID uint) (models.User, bool) {
+	var reader models.User
+	readerID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reader ID"})
+		return reader, false
+	}
+	if err := config.DB.Where("id = ? AND lib_id = ? AND role = ?", readerID, libID, "Reader").First(&reader).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reader not found"})
+		return reader, false
+	}
+	return reader, true
+}
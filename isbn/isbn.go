@@ -0,0 +1,90 @@
+// Package isbn validates ISBN-10 and ISBN-13 numbers and converts them to the
+// canonical form the catalog is keyed on: 13 digits without separators.
+package isbn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrLength is returned when an ISBN does not have 10 or 13 digits.
+	ErrLength = errors.New("must have 10 or 13 digits")
+	// ErrCharacter is returned for anything other than digits, hyphens,
+	// spaces and the X check digit of an ISBN-10.
+	ErrCharacter = errors.New("invalid character")
+	// ErrPrefix is returned for a 13-digit number that is not an ISBN.
+	ErrPrefix = errors.New("ISBN-13 must start with 978 or 979")
+	// ErrCheckDigit is returned when the last digit does not match the others.
+	ErrCheckDigit = errors.New("check digit does not match")
+)
+
+// Normalize validates s as an ISBN-10 or ISBN-13, ignoring hyphens and spaces,
+// and returns its ISBN-13 form. ISBN-10s are converted with the 978 prefix.
+func Normalize(s string) (string, error) {
+	var digits strings.Builder
+	position := 0
+	for _, r := range s {
+		position++
+		switch {
+		case r == '-' || r == ' ':
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == 'X' || r == 'x':
+			digits.WriteByte('X')
+		default:
+			return "", fmt.Errorf("%w %q at position %d", ErrCharacter, r, position)
+		}
+	}
+
+	d := digits.String()
+	if len(d) != 10 && len(d) != 13 {
+		return "", fmt.Errorf("%w, got %d", ErrLength, len(d))
+	}
+	if i := strings.IndexByte(d, 'X'); i >= 0 && (len(d) != 10 || i != 9) {
+		return "", fmt.Errorf("%w: X is only allowed as the check digit of an ISBN-10", ErrCharacter)
+	}
+
+	if len(d) == 10 {
+		if want := checkDigit10(d[:9]); d[9] != want {
+			return "", fmt.Errorf("%w, expected %c", ErrCheckDigit, want)
+		}
+		body := "978" + d[:9]
+		return body + string(checkDigit13(body)), nil
+	}
+
+	if !strings.HasPrefix(d, "978") && !strings.HasPrefix(d, "979") {
+		return "", ErrPrefix
+	}
+	if want := checkDigit13(d[:12]); d[12] != want {
+		return "", fmt.Errorf("%w, expected %c", ErrCheckDigit, want)
+	}
+	return d, nil
+}
+
+// checkDigit10 computes the ISBN-10 check digit of the first nine digits.
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(body[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 computes the ISBN-13 check digit of the first twelve digits.
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(body[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
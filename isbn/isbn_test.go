@@ -0,0 +1,62 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	valid := map[string]string{
+		"9780131103627":     "9780131103627",
+		"978-0-13-110362-7": "9780131103627",
+		"978 0 13 110362 7": "9780131103627",
+		"0131103628":        "9780131103627",
+		"0-13-110362-8":     "9780131103627",
+		"080442957X":        "9780804429573",
+		"080442957x":        "9780804429573",
+		"979-10-90636-07-1": "9791090636071",
+	}
+	for input, want := range valid {
+		got, err := Normalize(input)
+		if err != nil {
+			t.Errorf("Normalize(%q) returned error: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestNormalize_Invalid(t *testing.T) {
+	invalid := map[string]error{
+		"":                  ErrLength,
+		"12345":             ErrLength,
+		"97801311036270":    ErrLength,
+		"978-0-13-110362-8": ErrCheckDigit,
+		"0131103627":        ErrCheckDigit,
+		"9770131103624":     ErrPrefix,
+		"978013110362X":     ErrCharacter,
+		"08044X9573":        ErrCharacter,
+		"978_0131103627":    ErrCharacter,
+		"ISBN 0131103628":   ErrCharacter,
+	}
+	for input, want := range invalid {
+		if _, err := Normalize(input); !errors.Is(err, want) {
+			t.Errorf("Normalize(%q) error = %v, want %v", input, err, want)
+		}
+	}
+}
+
+func TestNormalize_ErrorMessages(t *testing.T) {
+	messages := map[string]string{
+		"12345":             "must have 10 or 13 digits, got 5",
+		"978-0-13-110362-8": "check digit does not match, expected 7",
+		"978#0131103627":    `invalid character '#' at position 4`,
+	}
+	for input, want := range messages {
+		if _, err := Normalize(input); err == nil || err.Error() != want {
+			t.Errorf("Normalize(%q) error = %v, want %q", input, err, want)
+		}
+	}
+}
@@ -25,7 +25,7 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // Adjust this as needed for production
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "X-User-Email"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-User-Email", "Idempotency-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -36,26 +36,40 @@ func main() {
 	{
 		// Unauthenticated endpoints:
 		api.POST("/signin", handlers.SignIn)             // SignIn endpoint
+		api.POST("/token/refresh", handlers.RefreshToken)   // Exchange a refresh token for a new pair
+		api.POST("/signout", handlers.SignOut)              // Revoke a refresh token
 		api.POST("/library/create", handlers.CreateLibrary) // Create library and owner
 		api.POST("/reader/create", handlers.CreateReader)   // Create Reader endpoint
 		api.GET("/libraries", handlers.ListLibraries)
 
-		// Global authentication middleware (checks for X-User-Email header)
+		// Global authentication middleware (verifies the bearer access token)
 		api.Use(middlewares.AuthMiddleware)
 
 		// Library Owner Flow: Onboard a LibraryAdmin.
 		api.POST("/owner/admin/create", handlers.CreateAdmin)
+		api.PUT("/owner/policy", handlers.UpdateCirculationPolicy)
+
+		// Circulation policy of the signed-in user's library.
+		api.GET("/policy", handlers.GetCirculationPolicy)
 
 		// Admin routes: accessible by Owner or LibraryAdmin.
 		adminGroup := api.Group("/admin")
 		adminGroup.Use(middlewares.AdminMiddleware)
 		{
 			adminGroup.POST("/books", handlers.AddBook)
+			adminGroup.POST("/books/import", middlewares.IdempotencyMiddleware, handlers.ImportBooks)
+			adminGroup.GET("/books/export", handlers.ExportBooks)
 			adminGroup.DELETE("/books/:isbn", handlers.RemoveBook)
 			adminGroup.PUT("/books/:isbn", handlers.UpdateBook)
+			adminGroup.GET("/books/:isbn/copies", handlers.ListBookCopies)
+			adminGroup.PUT("/copies/:barcode", handlers.UpdateBookCopy)
 			adminGroup.GET("/requests", handlers.ListIssueRequests)
-			adminGroup.POST("/requests/:reqid/approve", handlers.ApproveIssueRequest)
-			adminGroup.POST("/requests/:reqid/reject", handlers.RejectIssueRequest)
+			adminGroup.POST("/requests/:reqid/approve", middlewares.IdempotencyMiddleware, handlers.ApproveIssueRequest)
+			adminGroup.POST("/requests/:reqid/reject", middlewares.IdempotencyMiddleware, handlers.RejectIssueRequest)
+			adminGroup.POST("/issues/:id/return", handlers.ReturnBook)
+			adminGroup.GET("/readers/:id/fines", handlers.GetReaderFines)
+			adminGroup.POST("/readers/:id/fines/payments", handlers.RecordFinePayment)
+			adminGroup.POST("/readers/:id/fines/waivers", handlers.WaiveFine)
 		}
 
 		// Reader routes.
@@ -63,10 +77,32 @@ func main() {
 		readerGroup.Use(middlewares.ReaderMiddleware)
 		{
 			readerGroup.GET("/books", handlers.SearchBooks)
-			readerGroup.POST("/request", handlers.RaiseIssueRequest)
+			readerGroup.POST("/request", middlewares.IdempotencyMiddleware, handlers.RaiseIssueRequest)
+			readerGroup.POST("/return", handlers.RaiseReturnRequest)
+			readerGroup.POST("/issues/:id/renew", handlers.RenewIssue)
+			readerGroup.POST("/holds", handlers.PlaceHold)
+			readerGroup.GET("/holds", handlers.ListHolds)
+			readerGroup.POST("/holds/:id/cancel", handlers.CancelHold)
+			readerGroup.GET("/fines", handlers.GetMyFines)
+			readerGroup.GET("/requests", handlers.ListMyRequests)
+			readerGroup.POST("/requests/:id/cancel", handlers.CancelRequest)
+			readerGroup.GET("/loans", handlers.ListMyLoans)
+			readerGroup.GET("/history", handlers.ListMyHistory)
 		}
 	}
 
+	// Expire ready holds whose pickup window has passed and purge old idempotency keys.
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := handlers.ExpireHolds(config.DB); err != nil {
+				log.Println("Error expiring holds:", err)
+			}
+			if err := middlewares.PurgeIdempotencyKeys(config.DB); err != nil {
+				log.Println("Error purging idempotency keys:", err)
+			}
+		}
+	}()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
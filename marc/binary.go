@@ -0,0 +1,198 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	leaderLength      = 24
+	directoryEntry    = 12
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+// defaultLeader is used for records written without a leader: a new,
+// Unicode-encoded monograph of language material.
+const defaultLeader = "00000nam a2200000 i 4500"
+
+// ErrInvalidRecord is returned for binary data that is not a MARC record.
+var ErrInvalidRecord = errors.New("marc: invalid record")
+
+// Reader reads binary MARC 21 records one at a time.
+type Reader struct {
+	r     *bufio.Reader
+	count int
+}
+
+// NewReader returns a Reader reading records from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF when there are no more. Line breaks
+// between records, which some exports add, are skipped. Records are expected
+// in UTF-8; MARC-8 text outside ASCII is passed through unconverted.
+func (r *Reader) Read() (*Record, error) {
+	for {
+		b, err := r.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		r.r.ReadByte()
+	}
+	r.count++
+
+	prefix, err := r.r.Peek(5)
+	if err != nil {
+		return nil, fmt.Errorf("%w: record %d is truncated", ErrInvalidRecord, r.count)
+	}
+	length, err := strconv.Atoi(string(prefix))
+	if err != nil || length < leaderLength+1 {
+		return nil, fmt.Errorf("%w: record %d has a bad length %q", ErrInvalidRecord, r.count, prefix)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, fmt.Errorf("%w: record %d is truncated", ErrInvalidRecord, r.count)
+	}
+	rec, err := parseBinary(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: record %d: %v", ErrInvalidRecord, r.count, err)
+	}
+	return rec, nil
+}
+
+// parseBinary decodes one ISO 2709 record.
+func parseBinary(data []byte) (*Record, error) {
+	if data[len(data)-1] != recordTerminator {
+		return nil, errors.New("missing record terminator")
+	}
+	base, err := strconv.Atoi(string(data[12:17]))
+	if err != nil || base <= leaderLength || base > len(data) {
+		return nil, fmt.Errorf("bad base address %q", data[12:17])
+	}
+	directory := data[leaderLength : base-1]
+	if len(directory)%directoryEntry != 0 {
+		return nil, errors.New("directory length is not a multiple of 12")
+	}
+
+	rec := &Record{Leader: string(data[:leaderLength])}
+	for i := 0; i < len(directory); i += directoryEntry {
+		entry := directory[i : i+directoryEntry]
+		tag := string(entry[:3])
+		length, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil || base+start+length > len(data) || length < 1 {
+			return nil, fmt.Errorf("bad directory entry for field %s", tag)
+		}
+		// Drop the field terminator.
+		raw := data[base+start : base+start+length-1]
+
+		field := Field{Tag: tag}
+		if field.IsControl() {
+			field.Value = string(raw)
+			rec.Fields = append(rec.Fields, field)
+			continue
+		}
+		if len(raw) < 2 {
+			return nil, fmt.Errorf("field %s has no indicators", tag)
+		}
+		field.Ind1, field.Ind2 = raw[0], raw[1]
+		for _, part := range bytes.Split(raw[2:], []byte{subfieldDelimiter}) {
+			if len(part) == 0 {
+				continue
+			}
+			field.Subfields = append(field.Subfields, Subfield{Code: part[0], Value: string(part[1:])})
+		}
+		rec.Fields = append(rec.Fields, field)
+	}
+	return rec, nil
+}
+
+// Writer writes binary MARC 21 records.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer writing records to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write encodes rec and writes it. The record length, base address and
+// directory are computed; the rest of the leader is taken from rec.
+func (w *Writer) Write(rec *Record) error {
+	data, err := marshalBinary(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(data)
+	return err
+}
+
+// marshalBinary encodes rec as ISO 2709, marking it as UTF-8.
+func marshalBinary(rec *Record) ([]byte, error) {
+	var directory, fields bytes.Buffer
+	for _, f := range rec.Fields {
+		if len(f.Tag) != 3 {
+			return nil, fmt.Errorf("marc: bad tag %q", f.Tag)
+		}
+		start := fields.Len()
+		if f.IsControl() {
+			fields.WriteString(f.Value)
+		} else {
+			fields.WriteByte(indicator(f.Ind1))
+			fields.WriteByte(indicator(f.Ind2))
+			for _, sf := range f.Subfields {
+				fields.WriteByte(subfieldDelimiter)
+				fields.WriteByte(sf.Code)
+				fields.WriteString(sf.Value)
+			}
+		}
+		fields.WriteByte(fieldTerminator)
+		length := fields.Len() - start
+		if length > 9999 || start > 99999 {
+			return nil, fmt.Errorf("marc: field %s is too long", f.Tag)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", f.Tag, length, start)
+	}
+	directory.WriteByte(fieldTerminator)
+	fields.WriteByte(recordTerminator)
+
+	base := leaderLength + directory.Len()
+	total := base + fields.Len()
+	if total > 99999 {
+		return nil, errors.New("marc: record is too long")
+	}
+
+	leader := []byte(rec.Leader)
+	if len(leader) != leaderLength {
+		leader = []byte(defaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", total))
+	leader[9] = 'a'
+	copy(leader[10:12], "22")
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+	copy(leader[20:24], "4500")
+
+	out := make([]byte, 0, total)
+	out = append(out, leader...)
+	out = append(out, directory.Bytes()...)
+	return append(out, fields.Bytes()...), nil
+}
+
+// indicator returns the indicator to write, using a blank for unset ones.
+func indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
@@ -0,0 +1,152 @@
+package marc
+
+import (
+	"strings"
+	"unicode"
+
+	"lms/backend/isbn"
+)
+
+// Book holds the catalog fields carried by a bibliographic record.
+type Book struct {
+	ISBN      string
+	Title     string
+	Authors   string
+	Publisher string
+	Version   string
+	Items     []Item
+}
+
+// Item is a physical copy listed in a record's 852 holdings fields.
+type Item struct {
+	Barcode       string
+	ShelfLocation string
+}
+
+// BookFromRecord extracts the catalog fields from a record:
+//
+//	020 $a       ISBN, the first one that is valid, in ISBN-13 form
+//	100/110 $a   main author, followed by each 700/710 $a
+//	245 $a $b    title and subtitle
+//	264 $b       publisher (second indicator 1), or 260 $b
+//	250 $a       edition
+//	852 $p $h    items: barcode and shelf location
+//
+// ISBD punctuation at the end of subfields is removed and personal names
+// entered surname first are turned around.
+func BookFromRecord(rec *Record) Book {
+	var book Book
+
+	for _, f := range rec.FieldsByTag("020") {
+		raw := f.Subfield('a')
+		// Qualifiers such as "(pbk.)" follow the number.
+		if i := strings.IndexAny(raw, " ("); i >= 0 {
+			raw = raw[:i]
+		}
+		if raw == "" {
+			continue
+		}
+		if normalized, err := isbn.Normalize(raw); err == nil {
+			book.ISBN = normalized
+			break
+		}
+		if book.ISBN == "" {
+			book.ISBN = raw
+		}
+	}
+
+	var authors []string
+	for _, tag := range []string{"100", "110", "700", "710"} {
+		for _, f := range rec.FieldsByTag(tag) {
+			if name := personalName(f); name != "" {
+				authors = append(authors, name)
+			}
+		}
+	}
+	book.Authors = strings.Join(authors, ", ")
+
+	if fields := rec.FieldsByTag("245"); len(fields) > 0 {
+		title := trimPunctuation(fields[0].Subfield('a'))
+		if subtitle := trimPunctuation(fields[0].Subfield('b')); subtitle != "" {
+			title += " : " + subtitle
+		}
+		book.Title = title
+	}
+
+	for _, f := range rec.FieldsByTag("264") {
+		if f.Ind2 == '1' {
+			book.Publisher = trimPunctuation(f.Subfield('b'))
+			break
+		}
+	}
+	if book.Publisher == "" {
+		if fields := rec.FieldsByTag("260"); len(fields) > 0 {
+			book.Publisher = trimPunctuation(fields[0].Subfield('b'))
+		}
+	}
+
+	if fields := rec.FieldsByTag("250"); len(fields) > 0 {
+		book.Version = trimPunctuation(fields[0].Subfield('a'))
+	}
+
+	for _, f := range rec.FieldsByTag("852") {
+		book.Items = append(book.Items, Item{
+			Barcode:       strings.TrimSpace(f.Subfield('p')),
+			ShelfLocation: strings.TrimSpace(f.Subfield('h')),
+		})
+	}
+	return book
+}
+
+// RecordFromBook builds a record for a book. The whole Authors string goes in
+// a single 100 field in direct order, so importing the record again gives
+// back the same book.
+func RecordFromBook(book Book) *Record {
+	rec := &Record{Leader: defaultLeader}
+	rec.AddControlField("001", book.ISBN)
+	rec.AddDataField("020", ' ', ' ', "a", book.ISBN)
+	titleInd1 := byte('0')
+	if book.Authors != "" {
+		rec.AddDataField("100", '0', ' ', "a", book.Authors)
+		titleInd1 = '1'
+	}
+	rec.AddDataField("245", titleInd1, '0', "a", book.Title)
+	if book.Version != "" {
+		rec.AddDataField("250", ' ', ' ', "a", book.Version)
+	}
+	if book.Publisher != "" {
+		rec.AddDataField("264", ' ', '1', "b", book.Publisher)
+	}
+	for _, item := range book.Items {
+		rec.AddDataField("852", ' ', ' ', "h", item.ShelfLocation, "p", item.Barcode)
+	}
+	return rec
+}
+
+// personalName returns a name heading in direct order. Names with first
+// indicator 1 are entered surname first ("Kernighan, Brian W.").
+func personalName(f Field) string {
+	name := trimPunctuation(f.Subfield('a'))
+	if f.Ind1 == '1' && (f.Tag == "100" || f.Tag == "700") {
+		if surname, forenames, ok := strings.Cut(name, ", "); ok {
+			name = forenames + " " + surname
+		}
+	}
+	return name
+}
+
+// trimPunctuation strips the ISBD punctuation that ends MARC subfields. A
+// final full stop is kept after an initial, as in "Brian W.".
+func trimPunctuation(s string) string {
+	s = strings.TrimRight(strings.TrimSpace(s), " /:;,=")
+	if strings.HasSuffix(s, ".") && !endsWithInitial(s) {
+		s = strings.TrimSpace(strings.TrimSuffix(s, "."))
+	}
+	return s
+}
+
+func endsWithInitial(s string) bool {
+	runes := []rune(strings.TrimSuffix(s, "."))
+	n := len(runes)
+	return n >= 1 && unicode.IsUpper(runes[n-1]) && (n == 1 || runes[n-2] == ' ' || runes[n-2] == '.')
+}
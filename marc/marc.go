@@ -0,0 +1,71 @@
+// Package marc reads and writes MARC 21 bibliographic records, both in the
+// binary ISO 2709 transmission format and as MARCXML, and maps them to the
+// catalog fields the library keeps for a book.
+package marc
+
+import "strings"
+
+// Record is a MARC 21 record: a 24-character leader followed by fields.
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+// Field is either a control field (tags 001-009), which only has a Value, or
+// a data field with two indicators and a list of subfields.
+type Field struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Value     string
+	Subfields []Subfield
+}
+
+// Subfield is one coded part of a data field, such as $a.
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// IsControl reports whether the field is a control field.
+func (f Field) IsControl() bool {
+	return strings.HasPrefix(f.Tag, "00")
+}
+
+// Subfield returns the value of the first subfield with the given code.
+func (f Field) Subfield(code byte) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value
+		}
+	}
+	return ""
+}
+
+// FieldsByTag returns the record's fields with the given tag, in order.
+func (r *Record) FieldsByTag(tag string) []Field {
+	var fields []Field
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// AddControlField appends a control field.
+func (r *Record) AddControlField(tag, value string) {
+	r.Fields = append(r.Fields, Field{Tag: tag, Value: value})
+}
+
+// AddDataField appends a data field. Subfields are given as code, value
+// pairs; pairs with an empty value are left out.
+func (r *Record) AddDataField(tag string, ind1, ind2 byte, subfields ...string) {
+	field := Field{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for i := 0; i+1 < len(subfields); i += 2 {
+		if subfields[i+1] != "" {
+			field.Subfields = append(field.Subfields, Subfield{Code: subfields[i][0], Value: subfields[i+1]})
+		}
+	}
+	r.Fields = append(r.Fields, field)
+}
@@ -0,0 +1,127 @@
+package marc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// sampleBooks are the books described by testdata/sample.mrc and sample.xml.
+var sampleBooks = []Book{
+	{
+		ISBN:      "9780131103627",
+		Title:     "The C programming language",
+		Authors:   "Brian W. Kernighan, Dennis M. Ritchie",
+		Publisher: "Prentice Hall",
+		Version:   "2nd ed",
+		Items: []Item{
+			{Barcode: "B-0001", ShelfLocation: "QA76.73.C15 K47 1988"},
+			{Barcode: "B-0002", ShelfLocation: "QA76.73.C15 K47 1988"},
+		},
+	},
+	{
+		ISBN:      "9783161484100",
+		Title:     "Über Bücher : eine Einführung",
+		Authors:   "Jürgen Müller",
+		Publisher: "Mohr Siebeck",
+	},
+}
+
+type recordReader interface {
+	Read() (*Record, error)
+}
+
+func readAll(t *testing.T, r recordReader) []*Record {
+	t.Helper()
+	var records []*Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func openSample(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func booksFrom(records []*Record) []Book {
+	var books []Book
+	for _, rec := range records {
+		books = append(books, BookFromRecord(rec))
+	}
+	return books
+}
+
+func TestReader_SampleFile(t *testing.T) {
+	records := readAll(t, NewReader(openSample(t, "sample.mrc")))
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if got := records[0].FieldsByTag("001")[0].Value; got != "ocm17650642" {
+		t.Errorf("001 = %q", got)
+	}
+	title := records[0].FieldsByTag("245")[0]
+	if title.Ind1 != '1' || title.Ind2 != '4' {
+		t.Errorf("245 indicators = %q %q, want 1 4", title.Ind1, title.Ind2)
+	}
+	if got := booksFrom(records); !reflect.DeepEqual(got, sampleBooks) {
+		t.Errorf("books = %#v\nwant %#v", got, sampleBooks)
+	}
+}
+
+func TestXMLReader_SampleFile(t *testing.T) {
+	records := readAll(t, NewXMLReader(openSample(t, "sample.xml")))
+	if got := booksFrom(records); !reflect.DeepEqual(got, sampleBooks) {
+		t.Errorf("books = %#v\nwant %#v", got, sampleBooks)
+	}
+}
+
+func TestReader_Truncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.mrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(bytes.NewReader(data[:100]))
+	if _, err := r.Read(); err == nil {
+		t.Fatal("expected an error for a truncated record")
+	}
+}
+
+// Records written by either writer read back as the same books.
+func TestWriters_RoundTrip(t *testing.T) {
+	var binary, xml bytes.Buffer
+	w := NewWriter(&binary)
+	xw := NewXMLWriter(&xml)
+	for _, book := range sampleBooks {
+		if err := w.Write(RecordFromBook(book)); err != nil {
+			t.Fatal(err)
+		}
+		if err := xw.Write(RecordFromBook(book)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := booksFrom(readAll(t, NewReader(&binary))); !reflect.DeepEqual(got, sampleBooks) {
+		t.Errorf("binary round trip = %#v", got)
+	}
+	if got := booksFrom(readAll(t, NewXMLReader(&xml))); !reflect.DeepEqual(got, sampleBooks) {
+		t.Errorf("MARCXML round trip = %#v", got)
+	}
+}
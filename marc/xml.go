@@ -0,0 +1,143 @@
+package marc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Namespace is the MARCXML namespace.
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader reads records from a MARCXML document, either a collection or a
+// single record, one record at a time.
+type XMLReader struct {
+	d *xml.Decoder
+}
+
+// NewXMLReader returns an XMLReader reading from r.
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{d: xml.NewDecoder(r)}
+}
+
+// Read returns the next record, or io.EOF when there are no more.
+func (r *XMLReader) Read() (*Record, error) {
+	for {
+		token, err := r.d.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var x xmlRecord
+		if err := r.d.DecodeElement(&x, &start); err != nil {
+			return nil, fmt.Errorf("marc: invalid MARCXML record: %v", err)
+		}
+		rec := &Record{Leader: x.Leader}
+		for _, cf := range x.ControlFields {
+			rec.AddControlField(cf.Tag, cf.Value)
+		}
+		for _, df := range x.DataFields {
+			field := Field{Tag: df.Tag, Ind1: xmlIndicator(df.Ind1), Ind2: xmlIndicator(df.Ind2)}
+			for _, sf := range df.Subfields {
+				if sf.Code != "" {
+					field.Subfields = append(field.Subfields, Subfield{Code: sf.Code[0], Value: sf.Value})
+				}
+			}
+			rec.Fields = append(rec.Fields, field)
+		}
+		return rec, nil
+	}
+}
+
+func xmlIndicator(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
+
+// XMLWriter writes records as a MARCXML collection. Close must be called to
+// finish the document.
+type XMLWriter struct {
+	w       io.Writer
+	e       *xml.Encoder
+	started bool
+}
+
+// NewXMLWriter returns an XMLWriter writing to w.
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	return &XMLWriter{w: w, e: e}
+}
+
+func (w *XMLWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	_, err := io.WriteString(w.w, xml.Header+`<collection xmlns="`+Namespace+`">`)
+	return err
+}
+
+// Write appends rec to the collection.
+func (w *XMLWriter) Write(rec *Record) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	x := xmlRecord{Leader: rec.Leader}
+	if len(x.Leader) != leaderLength {
+		x.Leader = defaultLeader
+	}
+	for _, f := range rec.Fields {
+		if f.IsControl() {
+			x.ControlFields = append(x.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+			continue
+		}
+		df := xmlDataField{Tag: f.Tag, Ind1: string(indicator(f.Ind1)), Ind2: string(indicator(f.Ind2))}
+		for _, sf := range f.Subfields {
+			df.Subfields = append(df.Subfields, xmlSubfield{Code: string(sf.Code), Value: sf.Value})
+		}
+		x.DataFields = append(x.DataFields, df)
+	}
+	return w.e.Encode(x)
+}
+
+// Close ends the collection.
+func (w *XMLWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if err := w.e.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.w, "\n</collection>\n")
+	return err
+}
@@ -25,8 +25,38 @@ type User struct {
 	LibID         uint
 }
 
-// AuthMiddleware checks for the X-User-Email header and loads the user record.
+// AuthMiddleware verifies the bearer access token and sets the user from its claims.
+// The legacy X-User-Email header is only honoured when DevHeaderAuthEnabled is true.
 func AuthMiddleware(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		claims, err := ParseAccessToken(strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer ")))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		c.Set(string(UserContextKey), User{
+			ID:            claims.UserID,
+			Name:          claims.Name,
+			Email:         claims.Email,
+			ContactNumber: claims.ContactNumber,
+			Role:          claims.Role,
+			LibID:         claims.LibID,
+		})
+		c.Next()
+		return
+	}
+	if DevHeaderAuthEnabled() {
+		headerAuth(c)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Token missing"})
+	c.Abort()
+}
+
+// headerAuth checks for the X-User-Email header and loads the user record.
+func headerAuth(c *gin.Context) {
 	email := c.GetHeader("X-User-Email")
 	if strings.TrimSpace(email) == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Email header missing"})
@@ -0,0 +1,180 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"lms/backend/config"
+	"lms/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make a retry safe.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyKeyTTL is how long a key's response is replayed for.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyClaimTimeout is how long a key stays claimed by a request that
+// has not finished. An older claim is taken to belong to a request that died
+// with its process, and the key can be used again.
+const IdempotencyClaimTimeout = 5 * time.Minute
+
+// maxIdempotentBodySize caps the body of a request sent with an
+// Idempotency-Key, which is read into memory to be hashed. It leaves room for
+// the largest catalog import.
+const maxIdempotentBodySize = 16 << 20
+
+// responseRecorder copies the response body so it can be stored with the key.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// HashIdempotentRequest returns the value stored with an Idempotency-Key to
+// tell whether a retry carries the same query string and body.
+func HashIdempotentRequest(query string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(query))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// IdempotencyMiddleware makes a request carrying an Idempotency-Key header run
+// at most once per user and key. A retry with the same key gets the stored
+// response back; a retry while the first request is still running is refused,
+// as is reusing the key for a different route, query string or body. It must
+// run after AuthMiddleware. Requests without the header pass through.
+func IdempotencyMiddleware(c *gin.Context) {
+	key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+	if key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+		c.Abort()
+		return
+	}
+	user := c.MustGet(string(UserContextKey)).(User)
+	route := c.Request.Method + " " + c.Request.URL.Path
+
+	// The body is read to be hashed, then put back for the handler.
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentBodySize+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read request body"})
+			c.Abort()
+			return
+		}
+		if len(body) > maxIdempotentBodySize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	requestHash := HashIdempotentRequest(c.Request.URL.RawQuery, body)
+
+	// Keys past the replay window, and stale claims, are forgotten so they can
+	// be used again.
+	now := time.Now()
+	if err := config.DB.Where("user_id = ? AND key = ? AND (created_at < ? OR (status_code = 0 AND created_at < ?))",
+		user.ID, key, now.Add(-IdempotencyKeyTTL), now.Add(-IdempotencyClaimTimeout)).
+		Delete(&models.IdempotencyKey{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking idempotency key"})
+		c.Abort()
+		return
+	}
+
+	// Claiming the key with an insert lets the unique index decide which of
+	// two concurrent requests gets to run.
+	record := models.IdempotencyKey{UserID: user.ID, Key: key, Route: route, RequestHash: requestHash}
+	res := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking idempotency key"})
+		c.Abort()
+		return
+	}
+	if res.RowsAffected == 0 {
+		replayIdempotentResponse(c, user.ID, key, route, requestHash)
+		c.Abort()
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	// A handler that panics gives no answer to store, so its claim is
+	// released for the client to retry.
+	finished := false
+	defer func() {
+		if !finished {
+			config.DB.Delete(&record)
+		}
+	}()
+	c.Next()
+	finished = true
+
+	// Server errors are not a final answer, so the client may retry with the same key.
+	if recorder.Status() >= http.StatusInternalServerError {
+		config.DB.Delete(&record)
+		return
+	}
+	config.DB.Model(&record).Updates(map[string]interface{}{
+		"status_code":   recorder.Status(),
+		"response_body": recorder.body.Bytes(),
+	})
+}
+
+// replayIdempotentResponse answers a request whose key was already claimed.
+func replayIdempotentResponse(c *gin.Context, userID uint, key, route, requestHash string) {
+	var existing models.IdempotencyKey
+	err := config.DB.Where("user_id = ? AND key = ?", userID, key).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		// The first request failed and released the key in the meantime.
+		c.JSON(http.StatusConflict, gin.H{"error": "Request with this Idempotency-Key failed, please retry"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking idempotency key"})
+		return
+	}
+	switch {
+	case existing.Route != route, existing.RequestHash != requestHash:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+	case existing.StatusCode == 0:
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(existing.StatusCode, "application/json; charset=utf-8", existing.ResponseBody)
+	}
+}
+
+// PurgeIdempotencyKeys deletes keys that are past the replay window and
+// stale claims.
+func PurgeIdempotencyKeys(db *gorm.DB) error {
+	now := time.Now()
+	return db.Where("created_at < ? OR (status_code = 0 AND created_at < ?)",
+		now.Add(-IdempotencyKeyTTL), now.Add(-IdempotencyClaimTimeout)).Delete(&models.IdempotencyKey{}).Error
+}
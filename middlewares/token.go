@@ -0,0 +1,108 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"lms/backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// AccessTokenTTL is how long a signed access token stays valid.
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be exchanged for a new pair.
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Claims are the user fields carried inside a signed access token.
+type Claims struct {
+	UserID        uint   `json:"uid"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	ContactNumber string `json:"contactNumber,omitempty"`
+	Role          string `json:"role"`
+	LibID         uint   `json:"libId"`
+	jwt.RegisteredClaims
+}
+
+var errMissingSecret = errors.New("JWT_SECRET is not configured")
+
+func jwtSecret() ([]byte, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errMissingSecret
+	}
+	return []byte(secret), nil
+}
+
+// DevHeaderAuthEnabled reports whether the legacy X-User-Email header is accepted.
+// It is meant for local development only and is off unless AUTH_DEV_HEADER_MODE=true.
+func DevHeaderAuthEnabled() bool {
+	return os.Getenv("AUTH_DEV_HEADER_MODE") == "true"
+}
+
+// IssueAccessToken signs a short-lived access token for the user.
+func IssueAccessToken(user models.User) (string, time.Time, error) {
+	secret, err := jwtSecret()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+	claims := Claims{
+		UserID:        user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		ContactNumber: user.ContactNumber,
+		Role:          user.Role,
+		LibID:         user.LibID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token.
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	secret, err := jwtSecret()
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// NewRefreshToken generates an opaque refresh token. Only its hash is stored.
+func NewRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashRefreshToken returns the value persisted for a refresh token.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
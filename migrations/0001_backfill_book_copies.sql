@@ -0,0 +1,70 @@
+-- Backfill book_copies for books created before copies were tracked.
+--
+-- Run after AutoMigrate has created book_copies and the copy_id columns on
+-- issue_registries and holds. Each existing book gets total_copies copies with
+-- generated LEGACY-<isbn>-<n> barcodes: one Issued copy per open loan, one
+-- OnHold copy per ready hold and the rest Available. Open loans and ready holds
+-- are then linked to their copies, and the counts are recomputed.
+
+BEGIN;
+
+WITH stock AS (
+    SELECT b.isbn,
+           b.lib_id,
+           b.total_copies,
+           (SELECT COUNT(*) FROM issue_registries i
+             WHERE i.isbn = b.isbn AND i.issue_status = 'Issued' AND i.deleted_at IS NULL) AS issued,
+           (SELECT COUNT(*) FROM holds h
+             WHERE h.isbn = b.isbn AND h.lib_id = b.lib_id AND h.status = 'Ready' AND h.deleted_at IS NULL) AS ready
+      FROM books b
+     WHERE NOT EXISTS (SELECT 1 FROM book_copies c WHERE c.isbn = b.isbn AND c.lib_id = b.lib_id)
+)
+INSERT INTO book_copies (created_at, updated_at, isbn, lib_id, barcode, condition, shelf_location, status)
+SELECT now(), now(), s.isbn, s.lib_id,
+       'LEGACY-' || s.isbn || '-' || n,
+       'Good', '',
+       CASE
+           WHEN n <= s.issued THEN 'Issued'
+           WHEN n <= s.issued + s.ready THEN 'OnHold'
+           ELSE 'Available'
+       END
+  FROM stock s
+  CROSS JOIN LATERAL generate_series(1, s.total_copies) AS n;
+
+WITH loans AS (
+    SELECT id, isbn, row_number() OVER (PARTITION BY isbn ORDER BY id) AS rn
+      FROM issue_registries
+     WHERE issue_status = 'Issued' AND copy_id IS NULL AND deleted_at IS NULL
+), issued AS (
+    SELECT id, isbn, row_number() OVER (PARTITION BY isbn ORDER BY id) AS rn
+      FROM book_copies
+     WHERE status = 'Issued' AND barcode LIKE 'LEGACY-%'
+)
+UPDATE issue_registries r
+   SET copy_id = c.id
+  FROM loans l
+  JOIN issued c ON c.isbn = l.isbn AND c.rn = l.rn
+ WHERE r.id = l.id;
+
+WITH ready AS (
+    SELECT id, isbn, lib_id, row_number() OVER (PARTITION BY isbn, lib_id ORDER BY id) AS rn
+      FROM holds
+     WHERE status = 'Ready' AND copy_id IS NULL AND deleted_at IS NULL
+), on_hold AS (
+    SELECT id, isbn, lib_id, row_number() OVER (PARTITION BY isbn, lib_id ORDER BY id) AS rn
+      FROM book_copies
+     WHERE status = 'OnHold' AND barcode LIKE 'LEGACY-%'
+)
+UPDATE holds h
+   SET copy_id = c.id
+  FROM ready r
+  JOIN on_hold c ON c.isbn = r.isbn AND c.lib_id = r.lib_id AND c.rn = r.rn
+ WHERE h.id = r.id;
+
+UPDATE books SET
+    total_copies = (SELECT COUNT(*) FROM book_copies c
+                     WHERE c.isbn = books.isbn AND c.lib_id = books.lib_id AND c.status <> 'Withdrawn' AND c.deleted_at IS NULL),
+    available_copies = (SELECT COUNT(*) FROM book_copies c
+                         WHERE c.isbn = books.isbn AND c.lib_id = books.lib_id AND c.status = 'Available' AND c.deleted_at IS NULL);
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Backfill request_events.status for requests raised before statuses existed.
+--
+-- Run after AutoMigrate has added the status and rejection_reason columns.
+-- Rejected requests used to be deleted, so every processed request left in
+-- the table was approved.
+
+UPDATE request_events
+   SET status = CASE WHEN approval_date IS NULL THEN 'Pending' ELSE 'Approved' END
+ WHERE status IS NULL OR status = '' OR (status = 'Pending' AND approval_date IS NOT NULL);
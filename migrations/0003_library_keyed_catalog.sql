@@ -0,0 +1,38 @@
+-- Key the catalog on (lib_id, isbn) so several libraries can hold the same ISBN.
+--
+-- Run before AutoMigrate picks up the new lib_id columns: existing rows have
+-- to be backfilled before the columns can be made NOT NULL. Until now an ISBN
+-- belonged to at most one library, so requests and loans take the library of
+-- their book, or of their reader when the book has since been removed.
+
+BEGIN;
+
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_pkey;
+DROP INDEX IF EXISTS idx_books_isbn;
+ALTER TABLE books ADD PRIMARY KEY (lib_id, isbn);
+
+ALTER TABLE request_events ADD COLUMN IF NOT EXISTS lib_id bigint;
+UPDATE request_events r
+   SET lib_id = b.lib_id
+  FROM books b
+ WHERE b.isbn = r.book_id AND (r.lib_id IS NULL OR r.lib_id = 0);
+UPDATE request_events r
+   SET lib_id = u.lib_id
+  FROM users u
+ WHERE u.id = r.reader_id AND (r.lib_id IS NULL OR r.lib_id = 0);
+ALTER TABLE request_events ALTER COLUMN lib_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_request_events_lib_id ON request_events (lib_id);
+
+ALTER TABLE issue_registries ADD COLUMN IF NOT EXISTS lib_id bigint;
+UPDATE issue_registries i
+   SET lib_id = b.lib_id
+  FROM books b
+ WHERE b.isbn = i.isbn AND (i.lib_id IS NULL OR i.lib_id = 0);
+UPDATE issue_registries i
+   SET lib_id = u.lib_id
+  FROM users u
+ WHERE u.id = i.reader_id AND (i.lib_id IS NULL OR i.lib_id = 0);
+ALTER TABLE issue_registries ALTER COLUMN lib_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_issue_registries_lib_id ON issue_registries (lib_id);
+
+COMMIT;
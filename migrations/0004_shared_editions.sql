@@ -0,0 +1,33 @@
+-- Move bibliographic metadata from books onto shared editions keyed by ISBN.
+--
+-- Run before AutoMigrate so the editions exist before books references them.
+-- Where several libraries hold the same ISBN with differing metadata, the
+-- record of the library that catalogued it first (lowest lib_id) is kept.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS editions (
+    isbn       text PRIMARY KEY,
+    title      text NOT NULL,
+    authors    text NOT NULL,
+    publisher  text,
+    version    text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+INSERT INTO editions (isbn, title, authors, publisher, version, created_at, updated_at)
+SELECT DISTINCT ON (isbn) isbn, title, authors, publisher, version, now(), now()
+  FROM books
+ ORDER BY isbn, lib_id
+ON CONFLICT (isbn) DO NOTHING;
+
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS shelf_location text,
+    ADD CONSTRAINT fk_books_edition FOREIGN KEY (isbn) REFERENCES editions (isbn),
+    DROP COLUMN title,
+    DROP COLUMN authors,
+    DROP COLUMN publisher,
+    DROP COLUMN version;
+
+COMMIT;
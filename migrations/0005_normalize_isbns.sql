@@ -0,0 +1,72 @@
+-- Rewrite stored ISBNs in their canonical ISBN-13 form (13 digits, no
+-- separators), the form every endpoint now normalizes its input to.
+--
+-- ISBNs with an invalid check digit are left untouched and listed in a NOTICE
+-- so they can be corrected by hand. If a library holds the same book under two
+-- spellings of its ISBN, the books update fails on the primary key and the
+-- whole migration rolls back; merge those holdings first.
+
+BEGIN;
+
+CREATE FUNCTION pg_temp.isbn13(raw text) RETURNS text AS $$
+DECLARE
+    d     text := upper(regexp_replace(raw, '[- ]', '', 'g'));
+    body  text;
+    total int  := 0;
+    digit text;
+BEGIN
+    IF d ~ '^[0-9]{9}[0-9X]$' THEN
+        FOR i IN 1..9 LOOP
+            total := total + (11 - i) * substr(d, i, 1)::int;
+        END LOOP;
+        total := total + CASE WHEN right(d, 1) = 'X' THEN 10 ELSE right(d, 1)::int END;
+        IF total % 11 <> 0 THEN
+            RETURN raw;
+        END IF;
+        body := '978' || left(d, 9);
+    ELSIF d ~ '^97[89][0-9]{10}$' THEN
+        body := left(d, 12);
+    ELSE
+        RETURN raw;
+    END IF;
+
+    total := 0;
+    FOR i IN 1..12 LOOP
+        total := total + substr(body, i, 1)::int * CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END;
+    END LOOP;
+    digit := ((10 - total % 10) % 10)::text;
+    IF length(d) = 13 AND right(d, 1) <> digit THEN
+        RETURN raw;
+    END IF;
+    RETURN body || digit;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Books reference editions, so add the canonical editions before moving the
+-- holdings over and drop the old ones afterwards.
+INSERT INTO editions (isbn, title, authors, publisher, version, created_at, updated_at)
+SELECT pg_temp.isbn13(isbn), title, authors, publisher, version, created_at, now()
+  FROM editions
+ WHERE isbn <> pg_temp.isbn13(isbn)
+ON CONFLICT (isbn) DO NOTHING;
+
+UPDATE books            SET isbn    = pg_temp.isbn13(isbn)    WHERE isbn    <> pg_temp.isbn13(isbn);
+UPDATE book_copies      SET isbn    = pg_temp.isbn13(isbn)    WHERE isbn    <> pg_temp.isbn13(isbn);
+UPDATE holds            SET isbn    = pg_temp.isbn13(isbn)    WHERE isbn    <> pg_temp.isbn13(isbn);
+UPDATE issue_registries SET isbn    = pg_temp.isbn13(isbn)    WHERE isbn    <> pg_temp.isbn13(isbn);
+UPDATE request_events   SET book_id = pg_temp.isbn13(book_id) WHERE book_id <> pg_temp.isbn13(book_id);
+
+DELETE FROM editions WHERE isbn <> pg_temp.isbn13(isbn);
+
+DO $$
+DECLARE
+    bad text;
+BEGIN
+    SELECT string_agg(isbn, ', ') INTO bad FROM editions WHERE isbn !~ '^97[89][0-9]{10}$';
+    IF bad IS NOT NULL THEN
+        RAISE NOTICE 'ISBNs that could not be normalized: %', bad;
+    END IF;
+END;
+$$;
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Full-text search over editions for SearchBooks' q parameter.
+--
+-- The index expression must match editionDocument in handlers/catalog.go
+-- exactly, or the planner will not use it.
+
+CREATE INDEX IF NOT EXISTS idx_editions_search ON editions USING GIN (
+    (setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+     setweight(to_tsvector('english', coalesce(authors, '')), 'B') ||
+     setweight(to_tsvector('english', coalesce(publisher, '')), 'C'))
+);
@@ -0,0 +1,7 @@
+-- Trigram indexes for SearchBooks' fuzzy mode and "did you mean" suggestions,
+-- which match editions.title and editions.authors by word similarity.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_editions_title_trgm ON editions USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_editions_authors_trgm ON editions USING GIN (authors gin_trgm_ops);
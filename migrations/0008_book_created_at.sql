@@ -0,0 +1,20 @@
+-- Record when a library added a book so SearchBooks can sort by date added.
+--
+-- Existing books take the creation time of their oldest copy.
+
+BEGIN;
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS created_at timestamptz;
+
+UPDATE books b
+   SET created_at = c.first_copy
+  FROM (SELECT lib_id, isbn, min(created_at) AS first_copy
+          FROM book_copies
+         GROUP BY lib_id, isbn) c
+ WHERE c.lib_id = b.lib_id AND c.isbn = b.isbn AND b.created_at IS NULL;
+
+UPDATE books SET created_at = now() WHERE created_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_books_lib_created_at ON books (lib_id, created_at);
+
+COMMIT;
@@ -0,0 +1,25 @@
+-- Allow a reader at most one active (Waiting or Ready) hold per book, so two
+-- concurrent PlaceHold requests cannot both queue the reader. PlaceHold inserts
+-- with ON CONFLICT DO NOTHING and relies on this index to refuse the second.
+--
+-- Duplicate Waiting holds are cancelled first, keeping the reader's Ready hold
+-- or else their oldest one. A reader with two Ready holds for the same book
+-- makes the index creation fail and the whole migration roll back; release one
+-- of the reserved copies by hand first.
+
+BEGIN;
+
+UPDATE holds h
+   SET status = 'Cancelled', updated_at = now()
+  FROM (SELECT id,
+               row_number() OVER (PARTITION BY lib_id, isbn, reader_id
+                                  ORDER BY status = 'Ready' DESC, placed_at, id) AS n
+          FROM holds
+         WHERE status IN ('Waiting', 'Ready') AND deleted_at IS NULL) d
+ WHERE d.id = h.id AND d.n > 1 AND h.status = 'Waiting';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_holds_active_reader
+    ON holds (lib_id, isbn, reader_id)
+ WHERE status IN ('Waiting', 'Ready') AND deleted_at IS NULL;
+
+COMMIT;
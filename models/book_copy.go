@@ -0,0 +1,24 @@
+package models
+
+import "gorm.io/gorm"
+
+// Copy statuses. Only Available copies can be issued; OnHold copies are
+// reserved for a ready hold and Withdrawn copies no longer count as stock.
+const (
+	CopyAvailable = "Available"
+	CopyOnHold    = "OnHold"
+	CopyIssued    = "Issued"
+	CopyWithdrawn = "Withdrawn"
+)
+
+// BookCopy is one physical item of a book held by a library. The book's
+// TotalCopies and AvailableCopies are derived from its copies.
+type BookCopy struct {
+	gorm.Model
+	ISBN          string `gorm:"index:idx_book_copies_book;not null"`
+	LibID         uint   `gorm:"index:idx_book_copies_book;not null"`
+	Barcode       string `gorm:"uniqueIndex;not null"`
+	Condition     string `gorm:"not null;default:Good"`
+	ShelfLocation string
+	Status        string `gorm:"index;not null"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "gorm.io/gorm"
+
+// CirculationPolicy holds the lending rules of a library. Libraries that have
+// not saved a policy use DefaultCirculationPolicy.
+type CirculationPolicy struct {
+	gorm.Model
+	LibID              uint `gorm:"uniqueIndex;not null"`
+	LoanPeriodDays     int  `gorm:"not null;default:14"`
+	MaxLoans           int  `gorm:"not null;default:5"`
+	MaxCopiesPerTitle  int  `gorm:"not null;default:1"`
+	MaxPendingRequests int  `gorm:"not null;default:5"`
+	MaxRenewals        int  `gorm:"not null;default:2"`
+	GraceDays          int  `gorm:"not null;default:0"`
+	HoldPickupDays     int  `gorm:"not null;default:3"`
+	// Fines are in the smallest currency unit. FinePerDay is charged for each
+	// day a book is returned late beyond GraceDays, and new issue requests are
+	// refused while the reader's balance exceeds MaxFineBalance.
+	FinePerDay     int64 `gorm:"not null;default:10"`
+	MaxFineBalance int64 `gorm:"not null;default:500"`
+}
+
+// DefaultCirculationPolicy returns the rules applied when a library has no stored policy.
+func DefaultCirculationPolicy(libID uint) CirculationPolicy {
+	return CirculationPolicy{
+		LibID:              libID,
+		LoanPeriodDays:     14,
+		MaxLoans:           5,
+		MaxCopiesPerTitle:  1,
+		MaxPendingRequests: 5,
+		MaxRenewals:        2,
+		GraceDays:          0,
+		HoldPickupDays:     3,
+		FinePerDay:         10,
+		MaxFineBalance:     500,
+	}
+}
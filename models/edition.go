@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Edition is the bibliographic record of a published edition, keyed by ISBN
+// and shared by every library that holds it. A library's holding of an
+// edition is its Book row, which carries the per-library copy counts and
+// shelf location.
+type Edition struct {
+	ISBN      string `gorm:"primaryKey"`
+	Title     string `gorm:"not null"`
+	Authors   string `gorm:"not null"`
+	Publisher string
+	Version   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
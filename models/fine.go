@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+// Fine ledger entry kinds. Charges raise a reader's balance; payments and
+// waivers lower it.
+const (
+	FineCharge  = "Charge"
+	FinePayment = "Payment"
+	FineWaiver  = "Waiver"
+)
+
+// FineEntry is one line of a reader's fines ledger. Amounts are always
+// positive and expressed in the smallest currency unit. CreatedAt records
+// when the entry was made and RecordedByID who made it.
+type FineEntry struct {
+	gorm.Model
+	ReaderID     uint   `gorm:"index;not null"`
+	LibID        uint   `gorm:"index;not null"`
+	IssueID      *uint  `gorm:"index"`
+	Kind         string `gorm:"not null"`
+	Amount       int64  `gorm:"not null"`
+	Note         string
+	RecordedByID *uint
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Hold statuses. Waiting holds form a FIFO queue per book; the head of the
+// queue becomes Ready when a copy is reserved for it.
+const (
+	HoldWaiting   = "Waiting"
+	HoldReady     = "Ready"
+	HoldFulfilled = "Fulfilled"
+	HoldExpired   = "Expired"
+	HoldCancelled = "Cancelled"
+)
+
+// Hold is a reader's place in the queue for a book with no available copies.
+type Hold struct {
+	gorm.Model
+	ISBN      string    `gorm:"index;not null"`
+	LibID     uint      `gorm:"index;not null"`
+	ReaderID  uint      `gorm:"index;not null"`
+	Status    string    `gorm:"index;not null"`
+	PlacedAt  time.Time `gorm:"not null"`
+	ReadyAt   *time.Time
+	ExpiresAt *time.Time
+	// CopyID is the copy reserved for the reader once the hold is Ready.
+	CopyID *uint
+}
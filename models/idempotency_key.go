@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// IdempotencyKey records the response to a request sent with an
+// Idempotency-Key header so that client retries are answered from the record
+// instead of being processed again. A zero StatusCode means the first
+// request is still in progress, or died with its process if the record is
+// older than middlewares.IdempotencyClaimTimeout.
+type IdempotencyKey struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"uniqueIndex:idx_idempotency_keys_user_key;not null"`
+	Key    string `gorm:"uniqueIndex:idx_idempotency_keys_user_key;size:255;not null"`
+	Route  string `gorm:"not null"`
+	// RequestHash is middlewares.HashIdempotentRequest of the query string
+	// and body, so a key reused for a different request is refused.
+	RequestHash  string `gorm:"size:64"`
+	StatusCode   int
+	ResponseBody []byte
+	CreatedAt    time.Time `gorm:"index"`
+}
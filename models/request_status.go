@@ -0,0 +1,11 @@
+package models
+
+// RequestEvent statuses. Pending requests wait for an admin; the others are
+// final and kept so readers and admins can see the history.
+const (
+	RequestPending   = "Pending"
+	RequestApproved  = "Approved"
+	RequestRejected  = "Rejected"
+	RequestCancelled = "Cancelled"
+	RequestExpired   = "Expired"
+)